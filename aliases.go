@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// defaultAliases are the aliases available without a startup file.
+var defaultAliases = map[string]string{
+	"mk": "adduser",
+	"rm": "rmuser",
+	"ls": "lsusers",
+}
+
+// builtins are the commands that the shell handles itself instead of
+// looking them up in ops.
+var builtins = map[string]struct{}{
+	"help":    struct{}{},
+	"replay":  struct{}{},
+	"history": struct{}{},
+}
+
+// aliases maps each alias to the name of the command it runs.
+var aliases = make(map[string]string)
+
+// readAliasFile reads aliases from a file with one "alias command" pair per
+// line. Blank lines and lines beginning with "#" are ignored. An alias that
+// is defined more than once with different commands is rejected.
+func readAliasFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fileAliases := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"alias command\"", path, lineno)
+		}
+		if existing, ok := fileAliases[fields[0]]; ok && existing != fields[1] {
+			return nil, fmt.Errorf("%s:%d: alias '%s' is ambiguous: it is defined as both '%s' and '%s'", path, lineno, fields[0], existing, fields[1])
+		}
+		fileAliases[fields[0]] = fields[1]
+	}
+	return fileAliases, scanner.Err()
+}
+
+// loadAliases installs the default aliases and those in the startup file, if
+// one is given; the file's aliases take precedence over the defaults. Each
+// alias must name an existing command and must not shadow one.
+func loadAliases(path string) error {
+	loaded := make(map[string]string)
+	for alias, command := range defaultAliases {
+		loaded[alias] = command
+	}
+	if len(path) != 0 {
+		fileAliases, err := readAliasFile(path)
+		if err != nil {
+			return err
+		}
+		for alias, command := range fileAliases {
+			loaded[alias] = command
+		}
+	}
+
+	for alias, command := range loaded {
+		if _, ok := ops[alias]; ok {
+			return fmt.Errorf("alias '%s' conflicts with the command of the same name", alias)
+		}
+		if _, ok := builtins[alias]; ok {
+			return fmt.Errorf("alias '%s' conflicts with the built-in command of the same name", alias)
+		}
+		if _, ok := ops[command]; !ok {
+			if _, ok := loaded[command]; ok {
+				return fmt.Errorf("alias '%s' refers to another alias, '%s'; aliases must refer to a command", alias, command)
+			}
+			return fmt.Errorf("alias '%s' refers to '%s', which is not a valid command", alias, command)
+		}
+	}
+	aliases = loaded
+	return nil
+}
+
+// aliasesFor returns the sorted aliases of a command.
+func aliasesFor(command string) []string {
+	var names []string
+	for alias, target := range aliases {
+		if target == command {
+			names = append(names, alias)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"io"
+	"strings"
+)
+
+// SetAllowedPrefixes reads a file of known collection prefixes, one per line.
+// Once set, deftag and addprefix refuse a prefix unless it is one of them or
+// begins one of them, so that a misspelled prefix, which would silently grant
+// nothing, is caught. An empty path removes the allow-list.
+func (mpcli *MrPlotterCLIModule) SetAllowedPrefixes(path string) error {
+	if len(path) == 0 {
+		mpcli.allowed = nil
+		return nil
+	}
+	allowed, err := readNames(path)
+	if err != nil {
+		return err
+	}
+	mpcli.allowed = allowed
+	return nil
+}
+
+// isAllowedPrefix returns true if the prefix is in the allow-list or begins
+// one of its entries.
+func (mpcli *MrPlotterCLIModule) isAllowedPrefix(pfx string) bool {
+	for _, allowed := range mpcli.allowed {
+		if strings.HasPrefix(allowed, pfx) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAllowedPrefixes returns true if every prefix is allowed, or if there is
+// no allow-list. Otherwise, it writes each prefix that is not.
+func (mpcli *MrPlotterCLIModule) checkAllowedPrefixes(output io.Writer, prefixes []string) bool {
+	if mpcli.allowed == nil {
+		return true
+	}
+	ok := true
+	for _, pfx := range prefixes {
+		if !mpcli.isAllowedPrefix(pfx) {
+			writeStringf(mpcli.errWriter(output), "Prefix %q is not in the allow-list (use --force to use it anyway)\n", pfx)
+			ok = false
+		}
+	}
+	return ok
+}
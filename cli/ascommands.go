@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"io"
+	"strings"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+)
+
+// placeholderPassword is given to accounts recreated from --as-commands
+// output. Passwords cannot be recovered from their hashes, so each account is
+// also locked until its password is set.
+const placeholderPassword = "CHANGEME"
+
+// writeCommand writes a command line that the REPL or replay can run, quoting
+// the arguments that need it.
+func writeCommand(output io.Writer, name string, args ...string) {
+	line := make([]string, 0, len(args)+1)
+	line = append(line, name)
+	for _, arg := range args {
+		line = append(line, quoteToken(arg))
+	}
+	writeStringln(output, strings.Join(line, " "))
+}
+
+// writeAccountCommands writes the commands that recreate an account, apart
+// from its password.
+func writeAccountCommands(output io.Writer, acc *accounts.MrPlotterAccount) {
+	if acc.Tags == nil {
+		writeStringf(output, "# %s [CORRUPT ENTRY]\n", acc.Username)
+		return
+	}
+	writeStringf(output, "# The password of %s must be set separately with setpassword or unlockaccount\n", acc.Username)
+	writeCommand(output, "adduser", append([]string{acc.Username, placeholderPassword}, sortedSlice(acc.Tags)...)...)
+	writeCommand(output, "lockaccount", acc.Username)
+}
+
+// writeTagDefCommand writes the command that recreates a tag definition.
+func writeTagDefCommand(output io.Writer, tagdef *accounts.MrPlotterTagDef) {
+	if len(tagdef.PathPrefix) == 0 {
+		writeStringf(output, "# %s [CORRUPT ENTRY]\n", tagdef.Tag)
+		return
+	}
+	writeCommand(output, "deftag", append([]string{tagdef.Tag}, sortedSlice(tagdef.PathPrefix)...)...)
+}
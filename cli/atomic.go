@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// grantAtomically grants a tag to every one of the users, or if any of them
+// cannot be granted it, to none of them.
+func (mpcli *MrPlotterCLIModule) grantAtomically(ctx context.Context, output io.Writer, usernames []string, tag string, force bool, understood bool) {
+	tags := []string{tag}
+	if mpcli.needsToken(TokenAllTag) {
+		if !mpcli.confirmAllTagToken(output, strings.Join(usernames, ", "), tags, understood) {
+			return
+		}
+	} else if !force && !mpcli.confirmAllTag(output, strings.Join(usernames, ", "), tags) {
+		return
+	}
+	missing := 0
+	for _, username := range usernames {
+		acc, err := mpcli.store.RetrieveAccount(ctx, username)
+		if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+			return
+		}
+		if acc == nil {
+			writeStringf(mpcli.errWriter(output), "Account %s does not exist\n", username)
+			missing++
+		} else if !force && !mpcli.checkTagLimit(ctx, output, username, tags) {
+			return
+		}
+	}
+	if missing != 0 {
+		writeStringln(mpcli.errWriter(output), "Not granting the tag to any user")
+		return
+	}
+	err := manage.GrantTagsAtomically(ctx, mpcli.store, usernames, tags)
+	if writeManageError(mpcli.errWriter(output), err) {
+		return
+	}
+	writeStringf(mpcli.infoWriter(output), "Granted %s to %d users\n", tag, len(usernames))
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/meta"
+)
+
+const redacted = "********"
+
+// defaultLogEntries is the number of audit entries shown by default.
+const defaultLogEntries = 20
+
+// SetOperator sets the name recorded in the audit log as having made each
+// change. It is for attribution only, not authentication.
+func (mpcli *MrPlotterCLIModule) SetOperator(operator string) {
+	mpcli.operator = operator
+}
+
+// redactArgs returns a copy of the arguments to a command with the secret
+// ones, such as passwords, replaced. The positions in secretargs do not count
+// the command's flags, wherever they appear. A password read from the
+// environment with --password-env is not among the arguments, so nothing is
+// redacted in its place.
+func (mpc *MrPlotterCommand) redactArgs(tokens []string) []string {
+	args := make([]string, len(tokens))
+	copy(args, tokens)
+	secret := make(map[int]struct{}, len(mpc.secretargs))
+	if !isFlag(passwordEnvOption, tokens) {
+		for _, i := range mpc.secretargs {
+			secret[i] = struct{}{}
+		}
+	}
+	position := 0
+	for j, arg := range args {
+		if isFlag(arg, mpc.flags) {
+			continue
+		}
+		if _, ok := secret[position]; ok {
+			args[j] = redacted
+		}
+		position++
+	}
+	return args
+}
+
+// RedactArgs returns a copy of the arguments to a command, which may belong
+// to a submodule such as "keys", with its passwords and keys replaced, as in
+// the audit log.
+func RedactArgs(cmd admincli.CLIModule, args []string) []string {
+	switch c := cmd.(type) {
+	case *MrPlotterCommand:
+		return c.redactArgs(args)
+	case *admincli.GenericCLIModule:
+		if len(args) != 0 {
+			for _, child := range c.MChildren {
+				if child.Name() == args[0] {
+					return append([]string{args[0]}, RedactArgs(child, args[1:])...)
+				}
+			}
+		}
+	}
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+	return redacted
+}
+
+func isFlag(token string, flags []string) bool {
+	for _, flag := range flags {
+		if token == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapMutating wraps each command that changes the configuration, including
+// those in submodules, so that it holds the configuration lock if locking is
+// enabled, and so that every successful invocation is recorded in the audit
+// log. Commands that only read the configuration are wrapped so that they
+// can read it at a single revision.
+func (mpcli *MrPlotterCLIModule) wrapMutating(cmds []admincli.CLIModule) []admincli.CLIModule {
+	return mpcli.wrapCommands(cmds, true)
+}
+
+// wrapCommands does the work of wrapMutating. Commands in submodules are not
+// recordable, since the shell that replays recorded commands only runs
+// top-level ones.
+func (mpcli *MrPlotterCLIModule) wrapCommands(cmds []admincli.CLIModule, recordable bool) []admincli.CLIModule {
+	for _, cmd := range cmds {
+		switch c := cmd.(type) {
+		case *MrPlotterCommand:
+			if c.mutates {
+				unwrapped := c.exec
+				if recordable {
+					mpcli.record(c)
+				}
+				mpcli.audit(c)
+				mpcli.lock(c)
+				mpcli.preview(c, unwrapped)
+				mpcli.guard(c)
+			} else {
+				mpcli.readSnapshot(c)
+			}
+		case *admincli.GenericCLIModule:
+			c.MChildren = mpcli.wrapCommands(c.MChildren, false)
+		}
+	}
+	return cmds
+}
+
+func (mpcli *MrPlotterCLIModule) audit(mpc *MrPlotterCommand) {
+	exec := mpc.exec
+	mpc.exec = func(ctx context.Context, output io.Writer, tokens ...string) bool {
+		failedBefore := mpcli.failed
+		mpcli.failed = false
+		argsOK := exec(ctx, output, tokens...)
+		if argsOK && !mpcli.failed {
+			entry := &meta.AuditEntry{
+				Time:     time.Now(),
+				Operator: mpcli.operator,
+				Command:  mpc.name,
+				Args:     mpc.redactArgs(tokens),
+			}
+			if err := mpcli.store.AppendAuditEntry(ctx, entry); err != nil {
+				writeStringf(mpcli.warnWriter(output), "Warning: could not record change in audit log: %v\n", err)
+			}
+		}
+		mpcli.failed = mpcli.failed || failedBefore
+		return argsOK
+	}
+}
+
+func (mpcli *MrPlotterCLIModule) logCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "log",
+		usageargs: "[n]",
+		hint:      "shows the last n changes recorded in the audit log (20 by default)",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 0 || len(tokens) == 1; !argsOK {
+				return
+			}
+			n := int64(defaultLogEntries)
+			if len(tokens) == 1 {
+				var err error
+				n, err = strconv.ParseInt(tokens[0], 10, 64)
+				if argsOK = err == nil && n > 0; !argsOK {
+					return
+				}
+			}
+			entries, err := mpcli.store.RetrieveRecentAuditEntries(ctx, n)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			for _, entry := range entries {
+				operator := entry.Operator
+				if len(operator) == 0 {
+					operator = "-"
+				}
+				writeStringf(output, "%s %s %s %s\n", entry.Time.Format(time.RFC3339), operator, entry.Command, strings.Join(entry.Args, " "))
+			}
+			return
+		},
+	}
+}
+
+func (mpcli *MrPlotterCLIModule) loginCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "login",
+		usageargs: "operator",
+		hint:      "sets the operator name recorded in the audit log for the rest of this session (this is attribution, not authentication)",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 1; !argsOK {
+				return
+			}
+			mpcli.operator = tokens[0]
+			return
+		},
+	}
+}
+
+func (mpcli *MrPlotterCLIModule) whoamiCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "whoami",
+		usageargs: "",
+		hint:      "shows the operator name recorded in the audit log",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 0; !argsOK {
+				return
+			}
+			if len(mpcli.operator) == 0 {
+				writeStringln(output, "No operator is set (use login or MRPLOTTER_OPERATOR)")
+			} else {
+				writeStringln(output, mpcli.operator)
+			}
+			return
+		},
+	}
+}
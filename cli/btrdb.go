@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/immesys/smartgridstore/admincli"
+
+	btrdb "gopkg.in/btrdb.v4"
+)
+
+var errNoBTrDB = errors.New("this command requires a BTrDB connection (use --btrdb)")
+
+// SetBTrDB sets the BTrDB connection used by commands that compare the
+// configuration against the collections that actually exist. It is optional;
+// without it, those commands report an error.
+func (mpcli *MrPlotterCLIModule) SetBTrDB(bc *btrdb.BTrDB) {
+	mpcli.bc = bc
+}
+
+func (mpcli *MrPlotterCLIModule) checkCollectionsCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "checkcollections",
+		usageargs: "",
+		hint:      "lists tag prefixes that match no BTrDB collection, and collections that no tag covers",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 0; !argsOK {
+				return
+			}
+			if mpcli.bc == nil {
+				writeError(mpcli.errWriter(output), errNoBTrDB)
+				return
+			}
+			collections, err := mpcli.bc.ListCollections(ctx, "")
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			sort.Strings(collections)
+			r := mpcli.newResolver(ctx)
+			err = r.preload()
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+
+			tags := make([]string, 0, len(r.tagdefs))
+			for tag := range r.tagdefs {
+				tags = append(tags, tag)
+			}
+			sort.Strings(tags)
+
+			covered := make(map[string]struct{})
+			var dead []string
+			for _, tag := range tags {
+				for _, pfx := range sortedSlice(r.tagdefs[tag].PathPrefix) {
+					live := false
+					for _, collection := range collections {
+						if strings.HasPrefix(collection, pfx) {
+							live = true
+							covered[collection] = struct{}{}
+						}
+					}
+					if !live {
+						dead = append(dead, fmt.Sprintf("%s: %q", tag, pfx))
+					}
+				}
+			}
+
+			writeStringf(output, "Tag prefixes matching no collection (%d):\n", len(dead))
+			for _, d := range dead {
+				writeStringf(output, "    %s\n", d)
+			}
+			writeStringf(output, "Collections not covered by any tag (%d):\n", len(collections)-len(covered))
+			for _, collection := range collections {
+				if _, ok := covered[collection]; !ok {
+					writeStringf(output, "    %s\n", collection)
+				}
+			}
+			return
+		},
+	}
+}
+
+func (mpcli *MrPlotterCLIModule) streamCountCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "streamcount",
+		usageargs: "username",
+		hint:      "counts the BTrDB streams, and the collections holding them, that a user's tags grant access to",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 1; !argsOK {
+				return
+			}
+			if mpcli.bc == nil {
+				writeError(mpcli.errWriter(output), errNoBTrDB)
+				return
+			}
+			acc, err := mpcli.store.RetrieveAccount(ctx, tokens[0])
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if acc == nil {
+				writeStringln(mpcli.errWriter(output), accountNotExists)
+				return
+			}
+
+			/* List the collections once, rather than once per prefix. */
+			collections, err := mpcli.bc.ListCollections(ctx, "")
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			r := mpcli.newResolver(ctx)
+			streams, visible := 0, 0
+			for _, collection := range collections {
+				_, ok, err := r.matchTags(acc.Tags, collection)
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				if !ok {
+					continue
+				}
+				found, err := mpcli.bc.LookupStreams(ctx, collection, false, nil, nil)
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				streams += len(found)
+				visible++
+			}
+			writeStringf(output, "%s can read %d streams in %d of %d collections\n", acc.Username, streams, visible, len(collections))
+			return
+		},
+	}
+}
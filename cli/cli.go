@@ -29,25 +29,39 @@
 package cli
 
 import (
+	"bufio"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
 	"github.com/SoftwareDefinedBuildings/mr-plotter/keys"
 	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
 
 	etcd "github.com/coreos/etcd/clientv3"
+	"golang.org/x/time/rate"
+	btrdb "gopkg.in/btrdb.v4"
 )
 
 // MrPlotterCommand encapsulates a CLI command.
 type MrPlotterCommand struct {
-	name      string
-	usageargs string
-	hint      string
-	exec      func(ctx context.Context, output io.Writer, tokens ...string) bool
+	name        string
+	usageargs   string
+	hint        string
+	mutates     bool
+	previewable bool
+	destructive bool
+	secretargs  []int
+	flags       []string
+	exec        func(ctx context.Context, output io.Writer, tokens ...string) bool
 }
 
 // Children return nil.
@@ -101,6 +115,47 @@ func setToSlice(tagSet map[string]struct{}) []string {
 	return tagSlice
 }
 
+func sortedSlice(set map[string]struct{}) []string {
+	slice := setToSlice(set)
+	sort.Strings(slice)
+	return slice
+}
+
+// extractFlag removes every occurrence of the option flag from tokens. It
+// returns the remaining tokens and whether the option was present.
+func extractFlag(tokens []string, flag string) ([]string, bool) {
+	remaining := make([]string, 0, len(tokens))
+	present := false
+	for _, token := range tokens {
+		if token == flag {
+			present = true
+		} else {
+			remaining = append(remaining, token)
+		}
+	}
+	return remaining, present
+}
+
+// extractOption removes every occurrence of the option and the value that
+// follows it from tokens. It returns the remaining tokens, the last value
+// given, and false if the option appears without a value.
+func extractOption(tokens []string, option string) ([]string, string, bool) {
+	remaining := make([]string, 0, len(tokens))
+	value := ""
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i] != option {
+			remaining = append(remaining, tokens[i])
+			continue
+		}
+		if i+1 == len(tokens) {
+			return nil, "", false
+		}
+		i++
+		value = tokens[i]
+	}
+	return remaining, value, true
+}
+
 func writeStringln(output io.Writer, message string) error {
 	_, err := fmt.Fprintln(output, message)
 	return err
@@ -119,195 +174,451 @@ func writeError(output io.Writer, err error) (bool, error) {
 	return err != nil, err2
 }
 
+// manageErrors holds the messages for the errors defined by the manage
+// package, which are reported without the "Operation failed" preamble.
+var manageErrors = []struct {
+	err error
+	msg string
+}{
+	{manage.ErrAlreadyExists, alreadyExists},
+	{manage.ErrAccountNotExists, accountNotExists},
+	{manage.ErrTagNotExists, tagNotExists},
+	{manage.ErrTxFail, txFail},
+	{manage.ErrRevokePublic, fmt.Sprintf("All user accounts must be assigned the \"%s\" tag", accounts.PublicTag)},
+	{manage.ErrTxnTooLarge, fmt.Sprintf("Too many accounts for a single transaction (at most %d); grant the tag to each user with grant instead, without --atomic", manage.MaxTxnAccounts)},
+	{manage.ErrTagNotHeld, "Account does not hold the tag being replaced (use --force to grant the new tag anyway)"},
+	{manage.ErrNotLocked, "Account is not locked (use setpassword to change its password)"},
+	{manage.ErrNotBcrypt, "Not a well-formed bcrypt hash (other kinds of password hash cannot be imported)"},
+	{manage.ErrLastPrefix, "Each tag must be assigned at least one prefix (use undeftag or undeftags to fully remove a tag)"},
+}
+
+// writeManageError writes an error returned by the manage package, returning
+// true if there was an error.
+func writeManageError(output io.Writer, err error) bool {
+	for _, me := range manageErrors {
+		if errors.Is(err, me.err) {
+			writeStringln(output, me.msg)
+			return true
+		}
+	}
+	waserr, _ := writeError(output, err)
+	return waserr
+}
+
 // MrPlotterCLIModule encapsulates the CLI module for configuring Mr. Plotter.
 type MrPlotterCLIModule struct {
-	ecl *etcd.Client
+	ecl          *etcd.Client
+	store        manage.Store
+	bc           *btrdb.BTrDB
+	input        *bufio.Scanner
+	errOutput    io.Writer
+	quiet        bool
+	interactive  bool
+	prefixSep    string
+	appendSep    bool
+	foldCase     bool
+	failed       bool
+	operator     string
+	limiter      *rate.Limiter
+	locking      bool
+	dryRun       bool
+	snapshot     bool
+	environment  string
+	recorder     io.Writer
+	maxTags      int
+	maxPrefixes  int
+	lastProgress time.Time
+	verified     *verifyCache
+	allowed      []string
+	tokenOps     map[string]struct{}
 }
 
 // NewMrPlotterCLIModule returns a new instance of MrPlotterCLIModule.
 func NewMrPlotterCLIModule(ecl *etcd.Client) *MrPlotterCLIModule {
-	return &MrPlotterCLIModule{ecl}
+	return &MrPlotterCLIModule{ecl: ecl, store: manage.NewEtcdStore(ecl), input: bufio.NewScanner(os.Stdin), prefixSep: DefaultPrefixSeparator}
+}
+
+// SetStore replaces the store through which commands read and write accounts
+// and tag definitions, which by default is backed by the etcd client passed
+// to NewMrPlotterCLIModule. Tests may use this to substitute a fake.
+func (mpcli *MrPlotterCLIModule) SetStore(store manage.Store) {
+	mpcli.store = store
+}
+
+// SetInput sets the scanner from which commands read additional input, such
+// as the tags that follow a lone "-" argument. Programs that read commands
+// from stdin should pass the same scanner here, so that buffered input is not
+// lost between the two.
+func (mpcli *MrPlotterCLIModule) SetInput(input *bufio.Scanner) {
+	mpcli.input = input
+}
+
+// SetQuiet controls whether informational messages, such as the number of
+// records deleted, are written. Command results and errors are always written.
+func (mpcli *MrPlotterCLIModule) SetQuiet(quiet bool) {
+	mpcli.quiet = quiet
+}
+
+// SetErrorOutput sets the writer to which error and usage messages are
+// written, so that they can be kept apart from command results. If it is not
+// set, errors are written to the same writer as the results.
+func (mpcli *MrPlotterCLIModule) SetErrorOutput(errOutput io.Writer) {
+	mpcli.errOutput = errOutput
+}
+
+// Failed returns true if an error message has been written since the last
+// call to ClearFailed.
+func (mpcli *MrPlotterCLIModule) Failed() bool {
+	return mpcli.failed
+}
+
+// ClearFailed resets the flag returned by Failed. It should be called before
+// running each command whose outcome is of interest.
+func (mpcli *MrPlotterCLIModule) ClearFailed() {
+	mpcli.failed = false
+}
+
+// failureWriter marks the module as failed whenever it is written to.
+type failureWriter struct {
+	mpcli  *MrPlotterCLIModule
+	output io.Writer
+}
+
+func (fw *failureWriter) Write(p []byte) (int, error) {
+	fw.mpcli.failed = true
+	return fw.output.Write(p)
+}
+
+// warnWriter returns the writer for warnings, which go to the same place as
+// error messages but do not cause the command to be treated as failed.
+func (mpcli *MrPlotterCLIModule) warnWriter(output io.Writer) io.Writer {
+	if mpcli.errOutput == nil {
+		return output
+	}
+	return mpcli.errOutput
+}
+
+// errWriter returns the writer for error messages. Writing to it marks the
+// command as failed.
+func (mpcli *MrPlotterCLIModule) errWriter(output io.Writer) io.Writer {
+	return &failureWriter{mpcli, mpcli.warnWriter(output)}
+}
+
+// infoWriter returns the writer for informational messages, which discards
+// them in quiet mode.
+func (mpcli *MrPlotterCLIModule) infoWriter(output io.Writer) io.Writer {
+	if mpcli.quiet {
+		return ioutil.Discard
+	}
+	return output
+}
+
+// expandStdin replaces each "-" token with the lines read from the input
+// scanner, up to EOF. Blank lines are skipped. In the interactive REPL, the
+// scanner is the one commands are typed into, so reading to EOF would end the
+// session; there the lines are read up to the first blank line instead.
+func (mpcli *MrPlotterCLIModule) expandStdin(tokens []string) ([]string, error) {
+	expanded := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if token != "-" {
+			expanded = append(expanded, token)
+			continue
+		}
+		for mpcli.input.Scan() {
+			line := strings.TrimSpace(mpcli.input.Text())
+			if len(line) != 0 {
+				expanded = append(expanded, line)
+			} else if mpcli.interactive {
+				break
+			}
+		}
+		if err := mpcli.input.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
 }
 
 // Children returns the CLI functions for the Mr. Plotter CLI module.
 func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 	etcdClient := mpcli.ecl
-	return []admincli.CLIModule{
+	return mpcli.wrapMutating([]admincli.CLIModule{
 		&MrPlotterCommand{
-			name:      "adduser",
-			usageargs: "username password [tag1] [tag2] ...",
-			hint:      "creates a new user account",
+			name:        "adduser",
+			usageargs:   "username {password | --password-env var} [tag1] [tag2] ...",
+			hint:        "creates a new user account",
+			mutates:     true,
+			previewable: true,
+			secretargs:  []int{1},
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
-				if argsOK = len(tokens) >= 2; !argsOK {
+				tokens, argsOK, ok := mpcli.passwordArg(output, tokens, 1)
+				if !ok {
 					return
 				}
-				tagSet := sliceToSet(tokens[2:])
-				tagSet[accounts.PublicTag] = struct{}{}
-				acc := &accounts.MrPlotterAccount{Username: tokens[0], Tags: tagSet}
-				acc.SetPassword([]byte(tokens[1]))
-				success, err := accounts.UpsertAccountAtomically(ctx, etcdClient, acc)
-				if !success {
-					writeStringln(output, alreadyExists)
+				if argsOK = len(tokens) >= 2; !argsOK {
 					return
 				}
-				writeError(output, err)
+				username := tokens[0]
+				if mpcli.foldCase {
+					username = strings.ToLower(username)
+					folded, err := foldedUsernames(ctx, mpcli.store)
+					if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+						return
+					}
+					if existing := findCaseCollision(folded, username); existing != "" {
+						writeStringf(mpcli.errWriter(output), "%s (conflicts with '%s')\n", alreadyExists, existing)
+						return
+					}
+				}
+				err := manage.AddUser(ctx, mpcli.store, username, tokens[1], tokens[2:])
+				writeManageError(mpcli.errWriter(output), err)
 				return
 			},
 		},
 		&MrPlotterCommand{
-			name:      "setpassword",
-			usageargs: "username password",
-			hint:      "sets a user's password",
+			name:        "setpassword",
+			usageargs:   "[--yes] username {password | --password-env var}",
+			hint:        "sets a user's password, after confirmation unless --yes is given",
+			mutates:     true,
+			destructive: true,
+			previewable: true,
+			secretargs:  []int{1},
+			flags:       []string{"--yes"},
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
-				if argsOK = len(tokens) == 2; !argsOK {
+				tokens, yes := extractFlag(tokens, "--yes")
+				tokens, argsOK, ok := mpcli.passwordArg(output, tokens, 1)
+				if !ok {
 					return
 				}
-				acc, err := accounts.RetrieveAccount(ctx, etcdClient, tokens[0])
-				if waserr, _ := writeError(output, err); waserr {
-					return
-				}
-				if acc == nil {
-					writeStringln(output, accountNotExists)
+				if argsOK = len(tokens) == 2; !argsOK {
 					return
 				}
-				acc.SetPassword([]byte(tokens[1]))
-				success, err := accounts.UpsertAccountAtomically(ctx, etcdClient, acc)
-				if !success {
-					writeStringln(output, txFail)
+				if !yes && !mpcli.confirmOverwritePassword(output, tokens[0]) {
 					return
 				}
-				writeError(output, err)
+				err := manage.SetPassword(ctx, mpcli.store, tokens[0], tokens[1])
+				writeManageError(mpcli.errWriter(output), err)
 				return
 			},
 		},
 		&MrPlotterCommand{
-			name:      "rmuser",
-			usageargs: "username1 [username2] [username3 ...]",
-			hint:      "deletes user accounts",
+			name:        "rmuser",
+			usageargs:   "username1 [username2] [username3 ...]",
+			hint:        "deletes user accounts (restore-user can bring them back until they are purged)",
+			mutates:     true,
+			destructive: true,
+			previewable: true,
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
 				if argsOK = len(tokens) >= 1; !argsOK {
 					return
 				}
-				for _, username := range tokens {
-					err := accounts.DeleteAccount(ctx, etcdClient, username)
-					if waserr, _ := writeError(output, err); waserr {
+				for i, username := range tokens {
+					if !mpcli.pause(ctx, output, i, len(tokens)) {
 						return
 					}
+					deleted, err := manage.DeleteUser(ctx, mpcli.store, username)
+					if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+						return
+					}
+					if !deleted {
+						writeStringf(mpcli.errWriter(output), "no such user: %s\n", username)
+					}
 				}
 				return
 			},
 		},
 		&MrPlotterCommand{
-			name:      "rmusers",
-			usageargs: "usernameprefix",
-			hint:      "deletes all user accounts with a certain prefix",
+			name:        "rmusers",
+			usageargs:   "[--yes] [--i-understand] usernameprefix",
+			hint:        "deletes all user accounts with a certain prefix, after listing them and asking for confirmation unless --yes is given (restore-user can bring them back until they are purged)",
+			mutates:     true,
+			destructive: true,
+			previewable: true,
+			flags:       []string{"--yes", understandFlag},
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+				tokens, yes := extractFlag(tokens, "--yes")
+				tokens, understood := extractFlag(tokens, understandFlag)
 				if argsOK = len(tokens) == 1; !argsOK {
 					return
 				}
-				n, err := accounts.DeleteMultipleAccounts(ctx, etcdClient, tokens[0])
+				accs, err := mpcli.store.RetrieveMultipleAccounts(ctx, tokens[0])
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				if len(accs) == 0 {
+					writeStringln(mpcli.infoWriter(output), "No accounts match")
+					return
+				}
+				usernames := make([]string, len(accs))
+				for i, acc := range accs {
+					usernames[i] = acc.Username
+				}
+				if len(tokens[0]) == 0 && mpcli.needsToken(TokenRmUsersAll) {
+					mpcli.confirmDeletion(output, "accounts", usernames, true)
+					if !mpcli.confirmToken(output, fmt.Sprintf("delete all %d accounts", len(usernames)), understood) {
+						return
+					}
+				} else if !mpcli.confirmDeletion(output, "accounts", usernames, yes) {
+					return
+				}
+				n := 0
+				for i, acc := range accs {
+					if !mpcli.pause(ctx, output, i, len(accs)) {
+						break
+					}
+					var deleted bool
+					deleted, err = manage.DeleteUser(ctx, mpcli.store, acc.Username)
+					if err != nil {
+						break
+					}
+					if deleted {
+						n++
+					}
+				}
 				if n == 1 {
-					writeStringln(output, "Deleted 1 account")
+					writeStringln(mpcli.infoWriter(output), "Deleted 1 account")
 				} else {
-					writeStringf(output, "Deleted %v accounts\n", n)
+					writeStringf(mpcli.infoWriter(output), "Deleted %v accounts\n", n)
 				}
-				writeError(output, err)
+				writeError(mpcli.errWriter(output), err)
 				return
 			},
 		},
 		&MrPlotterCommand{
-			name:      "grant",
-			usageargs: "username tag1 [tag2] [tag3] ...",
-			hint:      "grants permission to view streams with given tags",
+			name:        "grant",
+			usageargs:   "[--force] [--i-understand] [--tag-prefix prefix] username tag1 [tag2] [tag3] ... (\"-\" reads tags from stdin) | --atomic username1 [username2] ... tag",
+			hint:        "grants permission to view streams with given tags, or every tag defined now whose name begins with a prefix, or with --atomic grants one tag to several users in a single transaction",
+			mutates:     true,
+			previewable: true,
+			flags:       []string{"--force", understandFlag, "--atomic"},
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
-				if argsOK = len(tokens) >= 2; !argsOK {
+				tokens, force := extractFlag(tokens, "--force")
+				tokens, understood := extractFlag(tokens, understandFlag)
+				tokens, atomic := extractFlag(tokens, "--atomic")
+				tokens, tagPrefix, argsOK := extractOption(tokens, "--tag-prefix")
+				if argsOK = argsOK && (len(tokens) >= 2 || (tagPrefix != "" && len(tokens) == 1)) && !(atomic && tagPrefix != ""); !argsOK {
 					return
 				}
-				acc, err := accounts.RetrieveAccount(ctx, etcdClient, tokens[0])
-				if waserr, _ := writeError(output, err); waserr {
+				if atomic {
+					mpcli.grantAtomically(ctx, output, sortedSlice(sliceToSet(tokens[:len(tokens)-1])), tokens[len(tokens)-1], force, understood)
 					return
 				}
-				if acc == nil {
-					writeStringln(output, accountNotExists)
+				tags, err := mpcli.expandStdin(tokens[1:])
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
 					return
 				}
-				for _, tag := range tokens[1:] {
-					if _, ok := acc.Tags[tag]; !ok {
-						acc.Tags[tag] = struct{}{}
+				if tagPrefix != "" {
+					matched, ok := mpcli.tagsWithPrefix(ctx, output, tokens[0], tagPrefix, force)
+					if !ok {
+						return
 					}
+					tags = append(tags, matched...)
+				}
+				if mpcli.needsToken(TokenAllTag) {
+					if !mpcli.confirmAllTagToken(output, tokens[0], tags, understood) {
+						return
+					}
+				} else if !force && !mpcli.confirmAllTag(output, tokens[0], tags) {
+					return
 				}
-				success, err := accounts.UpsertAccountAtomically(ctx, etcdClient, acc)
-				if !success {
-					writeStringln(output, txFail)
+				if !force && !mpcli.checkTagLimit(ctx, output, tokens[0], tags) {
 					return
 				}
-				writeError(output, err)
+				_, err = manage.GrantTags(ctx, mpcli.store, tokens[0], tags)
+				writeManageError(mpcli.errWriter(output), err)
 				return
 			},
 		},
 		&MrPlotterCommand{
-			name:      "revoke",
-			usageargs: "username tag1 [tag2] [tag3] ...",
-			hint:      "revokes tags from a user's permission list",
+			name:        "revoke",
+			usageargs:   "username tag1 [tag2] [tag3] ... (\"-\" reads tags from stdin)",
+			hint:        "revokes tags from a user's permission list",
+			mutates:     true,
+			destructive: true,
+			previewable: true,
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
 				if argsOK = len(tokens) >= 2; !argsOK {
 					return
 				}
-				acc, err := accounts.RetrieveAccount(ctx, etcdClient, tokens[0])
-				if waserr, _ := writeError(output, err); waserr {
+				tags, err := mpcli.expandStdin(tokens[1:])
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
 					return
 				}
-				if acc == nil {
-					writeStringln(output, accountNotExists)
-					return
-				}
-				for _, tag := range tokens[1:] {
-					if tag == accounts.PublicTag {
-						writeStringf(output, "All user accounts must be assigned the \"%s\" tag\n", accounts.PublicTag)
-						return
-					}
-					if _, ok := acc.Tags[tag]; ok {
-						delete(acc.Tags, tag)
-					}
-				}
-				success, err := accounts.UpsertAccountAtomically(ctx, etcdClient, acc)
-				if !success {
-					writeStringln(output, txFail)
-					return
-				}
-				writeError(output, err)
+				_, err = manage.RevokeTags(ctx, mpcli.store, tokens[0], tags)
+				writeManageError(mpcli.errWriter(output), err)
 				return
 			},
 		},
 		&MrPlotterCommand{
 			name:      "showuser",
-			usageargs: "username1 [username2] [username3] ...",
-			hint:      "shows the tags granted to a user or users",
+			usageargs: "[--format template | --sep separator] [--show-hash [--force]] username1 [username2] [username3] ...",
+			hint:      "shows the tags granted to a user or users, and optionally their bcrypt password hashes",
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
-				if argsOK = len(tokens) >= 1; !argsOK {
+				tokens, showHash := extractFlag(tokens, "--show-hash")
+				tokens, force := extractFlag(tokens, "--force")
+				tokens, sep, argsOK := extractSeparator(tokens)
+				if !argsOK {
+					return
+				}
+				tokens, tmpl, argsOK, ok := mpcli.parseFormat(output, tokens)
+				if argsOK = argsOK && len(tokens) >= 1; !argsOK || !ok {
+					return
+				}
+				if showHash && !force && !mpcli.confirmShowHash(output) {
 					return
 				}
 				for _, username := range tokens {
-					acc, err := accounts.RetrieveAccount(ctx, etcdClient, username)
-					if waserr, _ := writeError(output, err); waserr {
+					acc, err := mpcli.store.RetrieveAccount(ctx, username)
+					if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
 						return
 					}
 					if acc == nil {
-						writeStringln(output, accountNotExists)
+						writeStringln(mpcli.errWriter(output), accountNotExists)
 						return
 					}
-					tagSlice := setToSlice(acc.Tags)
-					writeStringf(output, "%s: %s\n", username, strings.Join(tagSlice, " "))
+					if tmpl != nil {
+						record := newAccountRecord(acc)
+						if showHash {
+							record.PasswordHash = string(acc.PasswordHash)
+						}
+						if mpcli.writeTemplate(output, tmpl, record) != nil {
+							return
+						}
+						continue
+					}
+					writeStringln(output, formatList(username, setToSlice(acc.Tags), sep))
+					if showHash {
+						writeStringf(output, "%s password hash: %s\n", username, acc.PasswordHash)
+					}
 				}
 				return
 			},
 		},
 		&MrPlotterCommand{
 			name:      "lsusers",
-			usageargs: "[prefix]",
-			hint:      "shows the tags granted to all user accounts with a given prefix",
+			usageargs: "[--names-only | --format template | --as-commands | --sep separator] [--since time | --after time] [--before time] [prefix]",
+			hint:      "shows the tags granted to all user accounts with a given prefix, optionally only those changed within a window of time, or the commands that would recreate them",
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
-				if argsOK = len(tokens) == 0 || len(tokens) == 1; !argsOK {
+				tokens, namesOnly := extractFlag(tokens, "--names-only")
+				tokens, asCommands := extractFlag(tokens, "--as-commands")
+				tokens, sinceArg, argsOK := extractOption(tokens, "--since")
+				if !argsOK {
+					return
+				}
+				tokens, afterArg, argsOK := extractOption(tokens, "--after")
+				if !argsOK {
+					return
+				}
+				tokens, beforeArg, argsOK := extractOption(tokens, "--before")
+				if !argsOK {
+					return
+				}
+				tokens, sep, argsOK := extractSeparator(tokens)
+				if !argsOK {
+					return
+				}
+				tokens, tmpl, argsOK, ok := mpcli.parseFormat(output, tokens)
+				if argsOK = argsOK && (len(tokens) == 0 || len(tokens) == 1) && !(asCommands && (namesOnly || tmpl != nil)); !argsOK || !ok {
 					return
 				}
 
@@ -316,52 +627,126 @@ func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 					prefix = tokens[0]
 				}
 
-				accs, err := accounts.RetrieveMultipleAccounts(ctx, etcdClient, prefix)
-				if waserr, _ := writeError(output, err); waserr {
+				var modified map[string]time.Time
+				var unknown int
+				window, err := parseTimeWindow(sinceArg, afterArg, beforeArg)
+				if err != nil {
+					writeStringln(mpcli.errWriter(output), err.Error())
 					return
 				}
+				if window != nil {
+					modified, err = mpcli.store.RetrieveAccountModifiedTimes(ctx)
+					if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+						return
+					}
+				}
 
-				for _, acc := range accs {
-					if acc.Tags == nil {
+				err = mpcli.store.ForEachAccount(ctx, prefix, func(acc *accounts.MrPlotterAccount) error {
+					if modified != nil {
+						modifiedAt, ok := modified[acc.Username]
+						if !ok {
+							unknown++
+							return nil
+						}
+						if !window.contains(modifiedAt) {
+							return nil
+						}
+					}
+					if tmpl != nil {
+						if mpcli.writeTemplate(output, tmpl, newAccountRecord(acc)) != nil {
+							return errFormatFailed
+						}
+					} else if asCommands {
+						writeAccountCommands(output, acc)
+					} else if namesOnly {
+						writeStringln(output, acc.Username)
+					} else if acc.Tags == nil {
 						writeStringf(output, "%s [CORRUPT ENTRY]\n", acc.Username)
 					} else {
-						tagSlice := setToSlice(acc.Tags)
-						writeStringf(output, "%s: %s\n", acc.Username, strings.Join(tagSlice, " "))
+						writeStringln(output, formatList(acc.Username, setToSlice(acc.Tags), sep))
 					}
+					return nil
+				})
+				if err != errFormatFailed {
+					writeError(mpcli.errWriter(output), err)
+				}
+				if unknown == 1 {
+					writeStringln(mpcli.infoWriter(output), "Skipped 1 account with no recorded modification time")
+				} else if unknown != 0 {
+					writeStringf(mpcli.infoWriter(output), "Skipped %d accounts with no recorded modification time\n", unknown)
 				}
 				return
 			},
 		},
 		&MrPlotterCommand{
-			name:      "deftag",
-			usageargs: "tag pathprefix1 [pathprefix2] ...",
-			hint:      "defines a new tag",
+			name:        "deftag",
+			usageargs:   "[--force] tag pathprefix1 [pathprefix2] ...",
+			hint:        "defines a new tag",
+			mutates:     true,
+			previewable: true,
+			flags:       []string{"--force"},
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+				tokens, force := extractFlag(tokens, "--force")
 				if argsOK = len(tokens) >= 2; !argsOK {
 					return
 				}
-				pfxSet := sliceToSet(tokens[1:])
-				tagdef := &accounts.MrPlotterTagDef{Tag: tokens[0], PathPrefix: pfxSet}
-				success, err := accounts.UpsertTagDefAtomically(ctx, etcdClient, tagdef)
-				if !success {
-					writeStringln(output, alreadyExists)
+				prefixes := mpcli.checkPrefixes(output, tokens[1:])
+				if !force && !mpcli.checkAllowedPrefixes(output, prefixes) {
 					return
 				}
-				writeError(output, err)
+				err := manage.DefineTag(ctx, mpcli.store, tokens[0], prefixes)
+				writeManageError(mpcli.errWriter(output), err)
 				return
 			},
 		},
 		&MrPlotterCommand{
-			name:      "undeftag",
-			usageargs: "tag1 [tag2] [tag3] ...",
-			hint:      "deletes tag definitions",
+			name:        "copytagdef",
+			usageargs:   "srctag newtag",
+			hint:        "defines a new tag with the same prefixes as an existing tag",
+			mutates:     true,
+			previewable: true,
+			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+				if argsOK = len(tokens) == 2; !argsOK {
+					return
+				}
+				if tokens[0] == accounts.AllTag || tokens[1] == accounts.AllTag {
+					writeStringf(mpcli.errWriter(output), "The \"%s\" tag cannot be copied\n", accounts.AllTag)
+					return
+				}
+				srcdef, err := mpcli.store.RetrieveTagDef(ctx, tokens[0])
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				if srcdef == nil {
+					writeStringln(mpcli.errWriter(output), tagNotExists)
+					return
+				}
+				err = manage.DefineTag(ctx, mpcli.store, tokens[1], setToSlice(srcdef.PathPrefix))
+				writeManageError(mpcli.errWriter(output), err)
+				return
+			},
+		},
+		&MrPlotterCommand{
+			name:        "undeftag",
+			usageargs:   "tag1 [tag2] [tag3] ...",
+			hint:        "deletes tag definitions",
+			mutates:     true,
+			destructive: true,
+			previewable: true,
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
 				if argsOK = len(tokens) >= 1; !argsOK {
 					return
 				}
-				for _, tagname := range tokens {
-					err := accounts.DeleteTagDef(ctx, etcdClient, tagname)
-					if waserr, _ := writeError(output, err); waserr {
+				for i, tagname := range tokens {
+					if tagname == accounts.AllTag {
+						writeStringf(mpcli.warnWriter(output), "Skipping \"%s\": it is built in and cannot be deleted\n", accounts.AllTag)
+						continue
+					}
+					if !mpcli.pause(ctx, output, i, len(tokens)) {
+						return
+					}
+					err := mpcli.store.DeleteTagDef(ctx, tagname)
+					if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
 						return
 					}
 				}
@@ -369,116 +754,147 @@ func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 			},
 		},
 		&MrPlotterCommand{
-			name:      "undeftags",
-			usageargs: "prefix",
-			hint:      "deletes tag definitions beginning with a certain prefix",
+			name:        "undeftags",
+			usageargs:   "[--yes] prefix",
+			hint:        "deletes tag definitions beginning with a certain prefix, after listing them and asking for confirmation unless --yes is given",
+			mutates:     true,
+			destructive: true,
+			previewable: true,
+			flags:       []string{"--yes"},
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+				tokens, yes := extractFlag(tokens, "--yes")
 				if argsOK = len(tokens) == 1; !argsOK {
 					return
 				}
-				n, err := accounts.DeleteMultipleTagDefs(ctx, etcdClient, tokens[0])
+				tagdefs, err := mpcli.store.RetrieveMultipleTagDefs(ctx, tokens[0])
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				if len(tagdefs) == 0 {
+					writeStringln(mpcli.infoWriter(output), "No tag definitions match")
+					return
+				}
+				tags := make([]string, len(tagdefs))
+				for i, tagdef := range tagdefs {
+					tags[i] = tagdef.Tag
+				}
+				if !mpcli.confirmDeletion(output, "tag definitions", tags, yes) {
+					return
+				}
+				n, err := mpcli.store.DeleteMultipleTagDefs(ctx, tokens[0])
 				if n == 1 {
-					writeStringln(output, "Deleted 1 tag definition")
+					writeStringln(mpcli.infoWriter(output), "Deleted 1 tag definition")
 				} else {
-					writeStringf(output, "Deleted %v tag definitions\n", n)
+					writeStringf(mpcli.infoWriter(output), "Deleted %v tag definitions\n", n)
 				}
-				writeError(output, err)
+				writeError(mpcli.errWriter(output), err)
 				return
 			},
 		},
 		&MrPlotterCommand{
-			name:      "addprefix",
-			usageargs: "tag prefix1 [prefix2] [prefix3] ...",
-			hint:      "adds a path prefix to a tag definition",
+			name:        "addprefix",
+			usageargs:   "[--impact] [--force] tag prefix1 [prefix2] [prefix3] ... (\"-\" reads prefixes from stdin)",
+			hint:        "adds a path prefix to a tag definition, and with --impact, reports how many users gain it",
+			mutates:     true,
+			previewable: true,
+			flags:       []string{"--impact", "--force"},
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+				tokens, impact := extractFlag(tokens, "--impact")
+				tokens, force := extractFlag(tokens, "--force")
 				if argsOK = len(tokens) >= 2; !argsOK {
 					return
 				}
-				tagdef, err := accounts.RetrieveTagDef(ctx, etcdClient, tokens[0])
-				if waserr, _ := writeError(output, err); waserr {
+				prefixes, err := mpcli.expandStdin(tokens[1:])
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
 					return
 				}
-				if tagdef == nil {
-					writeStringln(output, tagNotExists)
+				prefixes = mpcli.checkPrefixes(output, prefixes)
+				if !force && !mpcli.checkAllowedPrefixes(output, prefixes) {
 					return
 				}
-				for _, pfx := range tokens[1:] {
-					if _, ok := tagdef.PathPrefix[pfx]; !ok {
-						tagdef.PathPrefix[pfx] = struct{}{}
-					}
+				if !force && !mpcli.checkPrefixLimit(ctx, output, tokens[0], prefixes) {
+					return
 				}
-				success, err := accounts.UpsertTagDefAtomically(ctx, etcdClient, tagdef)
-				if !success {
-					writeStringln(output, txFail)
+				added, err := manage.AddPrefixes(ctx, mpcli.store, tokens[0], prefixes)
+				if writeManageError(mpcli.errWriter(output), err) {
 					return
 				}
-				writeError(output, err)
+				if impact {
+					mpcli.writeImpact(ctx, output, tokens[0], "gain", added)
+				}
 				return
 			},
 		},
 		&MrPlotterCommand{
-			name:      "rmprefix",
-			usageargs: "tag prefix1 [prefix2] [prefix3] ...",
-			hint:      "removes a path prefix from a tag definition",
+			name:        "rmprefix",
+			usageargs:   "[--impact] tag prefix1 [prefix2] [prefix3] ...",
+			hint:        "removes a path prefix from a tag definition, and with --impact, reports how many users lose it",
+			mutates:     true,
+			destructive: true,
+			previewable: true,
+			flags:       []string{"--impact"},
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+				tokens, impact := extractFlag(tokens, "--impact")
 				if argsOK = len(tokens) >= 2; !argsOK {
 					return
 				}
-				tagdef, err := accounts.RetrieveTagDef(ctx, etcdClient, tokens[0])
-				if waserr, _ := writeError(output, err); waserr {
+				removed, err := manage.RemovePrefixes(ctx, mpcli.store, tokens[0], tokens[1:])
+				if writeManageError(mpcli.errWriter(output), err) {
 					return
 				}
-				if tagdef == nil {
-					writeStringln(output, tagNotExists)
-					return
-				}
-				for _, pfx := range tokens[1:] {
-					if _, ok := tagdef.PathPrefix[pfx]; ok {
-						if len(tagdef.PathPrefix) == 1 {
-							writeStringln(output, "Each tag must be assigned at least one prefix (use undeftag or undeftags to fully remove a tag)")
-							return
-						}
-						delete(tagdef.PathPrefix, pfx)
-					}
+				if impact {
+					mpcli.writeImpact(ctx, output, tokens[0], "lose", removed)
 				}
-				success, err := accounts.UpsertTagDefAtomically(ctx, etcdClient, tagdef)
-				if !success {
-					writeStringln(output, txFail)
-					return
-				}
-				writeError(output, err)
 				return
 			},
 		},
 		&MrPlotterCommand{
 			name:      "showtagdef",
-			usageargs: "tag1 [tag2] [tag3] ...",
-			hint:      "lists the prefixes assigned to a tag",
+			usageargs: "[--tree | --sep separator] tag1 [tag2] [tag3] ...",
+			hint:      "lists the prefixes assigned to a tag, or with --tree shows them as a tree",
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
-				if argsOK = len(tokens) >= 1; !argsOK {
+				tokens, asTree := extractFlag(tokens, "--tree")
+				tokens, sep, argsOK := extractSeparator(tokens)
+				if argsOK = argsOK && len(tokens) >= 1; !argsOK {
 					return
 				}
+				r := mpcli.newResolver(ctx)
 				for _, tagname := range tokens {
-					tagdef, err := accounts.RetrieveTagDef(ctx, etcdClient, tagname)
-					if waserr, _ := writeError(output, err); waserr {
+					if tagname == accounts.AllTag {
+						writeStringf(output, "%s: [ALL STREAMS]\n", tagname)
+						continue
+					}
+					tagdef, err := r.tagDef(tagname)
+					if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
 						return
 					}
 					if tagdef == nil {
-						writeStringln(output, tagNotExists)
+						writeStringln(mpcli.errWriter(output), tagNotExists)
 						return
 					}
-					pfxSlice := setToSlice(tagdef.PathPrefix)
-					writeStringf(output, "%s: %s\n", tagname, strings.Join(pfxSlice, " "))
+					if asTree {
+						writeStringf(output, "%s:\n", tagname)
+						mpcli.writeAccessTree(output, r, map[string]struct{}{tagname: struct{}{}})
+						continue
+					}
+					writeStringln(output, formatList(tagname, setToSlice(tagdef.PathPrefix), sep))
 				}
 				return
 			},
 		},
 		&MrPlotterCommand{
 			name:      "lstagdefs",
-			usageargs: "[tagprefix]",
-			hint:      "lists the prefixes assigned to all tags beginning with a given prefix",
+			usageargs: "[--tags-only | --format template | --as-commands | --sep separator] [tagprefix]",
+			hint:      "lists the prefixes assigned to all tags beginning with a given prefix, or the commands that would recreate them",
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
-				if argsOK = len(tokens) == 0 || len(tokens) == 1; !argsOK {
+				tokens, tagsOnly := extractFlag(tokens, "--tags-only")
+				tokens, asCommands := extractFlag(tokens, "--as-commands")
+				tokens, sep, argsOK := extractSeparator(tokens)
+				if !argsOK {
+					return
+				}
+				tokens, tmpl, argsOK, ok := mpcli.parseFormat(output, tokens)
+				if argsOK = argsOK && (len(tokens) == 0 || len(tokens) == 1) && !(asCommands && (tagsOnly || tmpl != nil)); !argsOK || !ok {
 					return
 				}
 
@@ -487,20 +903,33 @@ func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 					prefix = tokens[0]
 				}
 
-				tagdefs, err := accounts.RetrieveMultipleTagDefs(ctx, etcdClient, prefix)
-				if waserr, _ := writeError(output, err); waserr {
+				tagdefs, err := mpcli.store.RetrieveMultipleTagDefs(ctx, prefix)
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+
+				if asCommands {
+					for _, tagdef := range tagdefs {
+						writeTagDefCommand(output, tagdef)
+					}
 					return
 				}
 
 				for _, tagdef := range tagdefs {
-					if tagdef.PathPrefix == nil {
+					if tmpl != nil {
+						if mpcli.writeTemplate(output, tmpl, newTagDefRecord(tagdef)) != nil {
+							return
+						}
+					} else if tagsOnly {
+						writeStringln(output, tagdef.Tag)
+					} else if tagdef.PathPrefix == nil {
 						writeStringf(output, "%s: [CORRUPT ENTRY]\n", tagdef.Tag)
 					} else {
 						pfxSlice := setToSlice(tagdef.PathPrefix)
 						for i := 0; i != len(pfxSlice); i++ {
 							pfxSlice[i] = fmt.Sprintf("%q", pfxSlice[i])
 						}
-						writeStringf(output, "%s: %s\n", tagdef.Tag, strings.Join(pfxSlice, " "))
+						writeStringln(output, formatList(tagdef.Tag, pfxSlice, sep))
 					}
 				}
 				return
@@ -508,10 +937,11 @@ func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 		},
 		&MrPlotterCommand{
 			name:      "lsconf",
-			usageargs: "[prefix]",
+			usageargs: "[--sep separator] [prefix]",
 			hint:      "lists the path prefixes currently visible to each user",
 			exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
-				if argsOK = len(tokens) == 0 || len(tokens) == 1; !argsOK {
+				tokens, sep, argsOK := extractSeparator(tokens)
+				if argsOK = argsOK && (len(tokens) == 0 || len(tokens) == 1); !argsOK {
 					return
 				}
 
@@ -520,65 +950,108 @@ func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 					prefix = tokens[0]
 				}
 
-				accs, err := accounts.RetrieveMultipleAccounts(ctx, etcdClient, prefix)
-				if waserr, _ := writeError(output, err); waserr {
+				r := mpcli.newResolver(ctx)
+				if err := r.preload(); err != nil {
+					writeStringf(mpcli.errWriter(output), "Could not retrieve tag information: %v\n", err)
 					return
 				}
 
-				tagcache := make(map[string]map[string]struct{})
-
-				for _, acc := range accs {
+				err := mpcli.store.ForEachAccount(ctx, prefix, func(acc *accounts.MrPlotterAccount) error {
 					if acc.Tags == nil {
 						writeStringf(output, "%s [CORRUPT ENTRY]\n", acc.Username)
 					} else {
-						prefixes := make(map[string]struct{})
-						for tag := range acc.Tags {
-							var tagPfxSet map[string]struct{}
-							var ok bool
-
-							if tagPfxSet, ok = tagcache[tag]; !ok {
-								tagdef, err := accounts.RetrieveTagDef(ctx, etcdClient, tag)
-								if err != nil {
-									writeStringf(output, "Could not retrieve tag information for '%s': %v\n", tag, err)
-									return
-								}
-								if tagdef == nil {
-									continue
-								}
-								tagPfxSet = tagdef.PathPrefix
-							}
-							for pfx := range tagPfxSet {
-								prefixes[pfx] = struct{}{}
-							}
+						notes, err := r.undefinedNotes(acc.Tags)
+						if err != nil {
+							return err
 						}
-						pfxSlice := setToSlice(prefixes)
-						for i := 0; i != len(pfxSlice); i++ {
-							pfxSlice[i] = fmt.Sprintf("%q", pfxSlice[i])
+						prefixes, err := r.prefixes(acc.Tags)
+						if err != nil {
+							return err
+						}
+						fields := make([]string, 0, len(prefixes)+len(notes))
+						for _, pfx := range sortedSlice(prefixes) {
+							fields = append(fields, fmt.Sprintf("%q", pfx))
 						}
-						writeStringf(output, "%s: %s\n", acc.Username, strings.Join(pfxSlice, " "))
+						fields = append(fields, notes...)
+						writeStringln(output, formatList(acc.Username, fields, sep))
 					}
-				}
+					return nil
+				})
+				writeError(mpcli.errWriter(output), err)
 				return
 			},
 		},
+		mpcli.statsCommand(),
+		mpcli.searchCommand(),
+		mpcli.pingCommand(),
+		mpcli.dupesCommand(),
+		mpcli.treeCommand(),
+		mpcli.canCommand(),
+		mpcli.tagsForCommand(),
+		mpcli.explainCommand(),
+		mpcli.logCommand(),
+		mpcli.loginCommand(),
+		mpcli.whoamiCommand(),
+		mpcli.importTagsCommand(),
+		mpcli.checkCollectionsCommand(),
+		mpcli.streamCountCommand(),
+		mpcli.grantAllCommand(),
+		mpcli.reapGrantsCommand(),
+		mpcli.purgeCommand(),
+		mpcli.restoreUserCommand(),
+		mpcli.checkPasswordCommand(),
+		mpcli.exportCommand(),
+		mpcli.importCommand(),
+		mpcli.diffConfigCommand(),
+		mpcli.diffUserCommand(),
+		mpcli.emptyUsersCommand(),
+		mpcli.deadGrantsCommand(),
+		mpcli.setPublicCommand(),
+		mpcli.revokeAllCommand(),
+		mpcli.swapTagCommand(),
+		mpcli.renameUsersCommand(),
+		mpcli.touchCommand(),
+		mpcli.exportHtpasswdCommand(),
+		mpcli.exportCSVCommand(),
+		mpcli.importHtpasswdCommand(),
+		mpcli.setHashCommand(),
+		mpcli.etcdKeysCommand(),
+		mpcli.showUsersCommand(),
+		mpcli.pruneTagsCommand(),
+		mpcli.topTagsCommand(),
+		mpcli.fatUsersCommand(),
+		mpcli.copyConfigCommand(),
+		mpcli.verifyCommand(),
+		mpcli.validateCommand(),
+		mpcli.previewGrantCommand(),
+		mpcli.previewRevokeCommand(),
+		mpcli.lockAccountCommand(),
+		mpcli.unlockAccountCommand(),
+		mpcli.normalizeCommand(),
+		mpcli.defRoleCommand(),
+		mpcli.checkRoleCommand(),
+		mpcli.applyRoleCommand(),
+		mpcli.groupUsersCommand(),
 		&admincli.GenericCLIModule{
 			MChildren: []admincli.CLIModule{
 				&MrPlotterCommand{
-					name:      "setcertsrc",
-					usageargs: "source",
-					hint:      "sets the method by which the certificate is obtained",
+					name:        "setcertsrc",
+					usageargs:   "source",
+					hint:        "sets the method by which the certificate is obtained",
+					mutates:     true,
+					destructive: true,
 					exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
 						if argsOK = len(tokens) == 1; !argsOK {
 							return
 						}
 						source := tokens[0]
 						if source != "autocert" && source != "hardcoded" && source != "config" {
-							writeStringf(output, "Argument to setcertsrc must be \"autocert\", \"hardcoded\", or \"config\"; got \"%v\"\n", source)
+							writeStringf(mpcli.errWriter(output), "Argument to setcertsrc must be \"autocert\", \"hardcoded\", or \"config\"; got \"%v\"\n", source)
 							return
 						}
 						err := keys.SetCertificateSource(ctx, etcdClient, source)
 						if err != nil {
-							writeStringf(output, "Could not set certificate source: %v\n", err)
+							writeStringf(mpcli.errWriter(output), "Could not set certificate source: %v\n", err)
 						}
 						return
 					},
@@ -593,7 +1066,7 @@ func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 						}
 						source, err := keys.GetCertificateSource(ctx, etcdClient)
 						if err != nil {
-							writeStringf(output, "Could not get certificate source: %v\n", err)
+							writeStringf(mpcli.errWriter(output), "Could not get certificate source: %v\n", err)
 						}
 						writeStringln(output, source)
 						return
@@ -605,13 +1078,14 @@ func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 							name:      "sethost",
 							usageargs: "hostname",
 							hint:      "sets the hostname for autocert",
+							mutates:   true,
 							exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
 								if argsOK = len(tokens) == 1; !argsOK {
 									return
 								}
 								err := keys.SetAutocertHostname(ctx, etcdClient, tokens[0])
 								if err != nil {
-									writeStringf(output, "Could not set autocert host: %v\n", err)
+									writeStringf(mpcli.errWriter(output), "Could not set autocert host: %v\n", err)
 								}
 								return
 							},
@@ -620,13 +1094,14 @@ func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 							name:      "setemail",
 							usageargs: "email",
 							hint:      "sets the email address for autocert",
+							mutates:   true,
 							exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
 								if argsOK = len(tokens) == 1; !argsOK {
 									return
 								}
 								err := keys.SetAutocertEmail(ctx, etcdClient, tokens[0])
 								if err != nil {
-									writeStringf(output, "Could not set autocert email: %v\n", err)
+									writeStringf(mpcli.errWriter(output), "Could not set autocert email: %v\n", err)
 								}
 								return
 							},
@@ -641,11 +1116,11 @@ func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 								}
 								hostname, err := keys.GetAutocertHostname(ctx, etcdClient)
 								if err != nil {
-									writeStringf(output, "Could not get autocert hostname: %v\n", err)
+									writeStringf(mpcli.errWriter(output), "Could not get autocert hostname: %v\n", err)
 								}
 								email, err := keys.GetAutocertEmail(ctx, etcdClient)
 								if err != nil {
-									writeStringf(output, "Could not get autocert email: %v\n", err)
+									writeStringf(mpcli.errWriter(output), "Could not get autocert email: %v\n", err)
 								}
 								writeStringf(output, "Hostname: %s\nEmail: %s\n", hostname, email)
 								return
@@ -659,27 +1134,30 @@ func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 					MRun:      nil,
 				},
 				&MrPlotterCommand{
-					name:      "sethardcoded",
-					usageargs: "cert key",
-					hint:      "sets the certificate to use when the source is set to \"hardcoded\"",
+					name:        "sethardcoded",
+					usageargs:   "cert key",
+					hint:        "sets the certificate to use when the source is set to \"hardcoded\"",
+					mutates:     true,
+					destructive: true,
+					secretargs:  []int{0, 1},
 					exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
 						if argsOK = len(tokens) == 2; !argsOK {
 							return
 						}
 						cert, err := base64.StdEncoding.DecodeString(tokens[0])
 						if err != nil {
-							writeStringf(output, "cert is not properly base64 encoded: %v\n", err)
+							writeStringf(mpcli.errWriter(output), "cert is not properly base64 encoded: %v\n", err)
 							return
 						}
 						key, err := base64.StdEncoding.DecodeString(tokens[1])
 						if err != nil {
-							writeStringf(output, "key is not properly base64 encoded: %v\n", err)
+							writeStringf(mpcli.errWriter(output), "key is not properly base64 encoded: %v\n", err)
 							return
 						}
 						htls := &keys.HardcodedTLSCertificate{Cert: cert, Key: key}
 						err = keys.UpsertHardcodedTLSCertificate(ctx, etcdClient, htls)
 						if err != nil {
-							writeStringf(output, "Could not set hardcoded certificate: %v\n", err)
+							writeStringf(mpcli.errWriter(output), "Could not set hardcoded certificate: %v\n", err)
 						}
 						return
 					},
@@ -694,7 +1172,7 @@ func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 						}
 						htls, err := keys.RetrieveHardcodedTLSCertificate(ctx, etcdClient)
 						if err != nil {
-							writeStringf(output, "Could not get hardcoded certificate: %v\n", err)
+							writeStringf(mpcli.errWriter(output), "Could not get hardcoded certificate: %v\n", err)
 							return
 						}
 						var cert string
@@ -708,27 +1186,30 @@ func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 					},
 				},
 				&MrPlotterCommand{
-					name:      "setsessionkeys",
-					usageargs: "encryptkey mackey",
-					hint:      "sets the session keys",
+					name:        "setsessionkeys",
+					usageargs:   "encryptkey mackey",
+					hint:        "sets the session keys",
+					mutates:     true,
+					destructive: true,
+					secretargs:  []int{0, 1},
 					exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
 						if argsOK = len(tokens) == 2; !argsOK {
 							return
 						}
 						encrypt, err := base64.StdEncoding.DecodeString(tokens[0])
 						if err != nil {
-							writeStringf(output, "encryptkey is not properly base64 encoded: %v\n", err)
+							writeStringf(mpcli.errWriter(output), "encryptkey is not properly base64 encoded: %v\n", err)
 							return
 						}
 						mac, err := base64.StdEncoding.DecodeString(tokens[1])
 						if err != nil {
-							writeStringf(output, "mackey is not properly base64 encoded: %v\n", err)
+							writeStringf(mpcli.errWriter(output), "mackey is not properly base64 encoded: %v\n", err)
 							return
 						}
 						sk := &keys.SessionKeys{EncryptKey: encrypt, MACKey: mac}
 						err = keys.UpsertSessionKeys(ctx, etcdClient, sk)
 						if err != nil {
-							writeStringf(output, "Could not set session keys: %v\n", err)
+							writeStringf(mpcli.errWriter(output), "Could not set session keys: %v\n", err)
 						}
 						return
 					},
@@ -743,7 +1224,7 @@ func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 						}
 						sk, err := keys.RetrieveSessionKeys(ctx, etcdClient)
 						if err != nil {
-							writeStringf(output, "Could not get session keys: %v\n", err)
+							writeStringf(mpcli.errWriter(output), "Could not get session keys: %v\n", err)
 							return
 						}
 						var encrypt string
@@ -763,7 +1244,7 @@ func (mpcli *MrPlotterCLIModule) Children() []admincli.CLIModule {
 			MRunnable: false,
 			MRun:      nil,
 		},
-	}
+	})
 }
 
 // Name returns "mrplotter"
@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// runCommand runs a command against a CLI module backed by store, returning
+// its output and whether it succeeded.
+func runCommand(t *testing.T, store manage.Store, name string, args ...string) (string, bool) {
+	mpcli := NewMrPlotterCLIModule(nil)
+	mpcli.SetStore(store)
+	for _, cmd := range mpcli.Children() {
+		if cmd.Name() != name {
+			continue
+		}
+		var output bytes.Buffer
+		argsOK := cmd.Run(context.Background(), &output, args...)
+		return output.String(), argsOK && !mpcli.Failed()
+	}
+	t.Fatalf("no command named %s", name)
+	return "", false
+}
+
+func TestLsconfUndefinedTag(t *testing.T) {
+	ctx := context.Background()
+	store := manage.NewMemoryStore()
+	err := store.UpsertTagDef(ctx, &accounts.MrPlotterTagDef{Tag: "staff", PathPrefix: map[string]struct{}{"/building/": struct{}{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, acc := range []*accounts.MrPlotterAccount{
+		{Username: "alice", Tags: map[string]struct{}{"staff": struct{}{}, "ghost": struct{}{}}},
+		{Username: "bob", Tags: map[string]struct{}{"staff": struct{}{}}},
+	} {
+		if err = store.UpsertAccount(ctx, acc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output, ok := runCommand(t, store, "lsconf")
+	if !ok {
+		t.Fatalf("lsconf failed:\n%s", output)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a line for each account, got:\n%s", output)
+	}
+	if !strings.HasPrefix(lines[0], "alice") || !strings.Contains(lines[0], "[tag ghost undefined]") || !strings.Contains(lines[0], "/building/") {
+		t.Errorf("expected alice's line to list her prefixes and note the undefined tag, got: %s", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "bob") || strings.Contains(lines[1], "undefined") {
+		t.Errorf("expected bob's line to be unaffected by alice's undefined tag, got: %s", lines[1])
+	}
+}
+
+func TestAddUserThenLsconf(t *testing.T) {
+	ctx := context.Background()
+	store := manage.NewMemoryStore()
+	err := store.UpsertTagDef(ctx, &accounts.MrPlotterTagDef{Tag: "staff", PathPrefix: map[string]struct{}{"/building/": struct{}{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, ok := runCommand(t, store, "adduser", "alice", "hunter2", "staff")
+	if !ok {
+		t.Fatalf("adduser failed:\n%s", output)
+	}
+	output, ok = runCommand(t, store, "lsconf")
+	if !ok {
+		t.Fatalf("lsconf failed:\n%s", output)
+	}
+	if !strings.HasPrefix(output, "alice") || !strings.Contains(output, "\"/building/\"") {
+		t.Errorf("expected lsconf to list the new account's prefixes, got:\n%s", output)
+	}
+
+	entries, err := store.RetrieveRecentAuditEntries(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Command != "adduser" || entries[0].Args[1] != redacted {
+		t.Errorf("expected adduser to be audited with its password redacted, got %+v", entries)
+	}
+}
+
+func TestRunWritesToOutput(t *testing.T) {
+	ctx := context.Background()
+	store := manage.NewMemoryStore()
+	err := store.UpsertTagDef(ctx, &accounts.MrPlotterTagDef{Tag: "staff", PathPrefix: map[string]struct{}{"/building/": struct{}{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, ok := runCommand(t, store, "showtagdef", "staff")
+	if !ok {
+		t.Fatalf("showtagdef failed:\n%s", output)
+	}
+	if !strings.HasPrefix(output, "staff") || !strings.Contains(output, "/building/") {
+		t.Errorf("expected Run to write the tag's prefixes to its output, got:\n%s", output)
+	}
+
+	output, ok = runCommand(t, store, "showtagdef", "ghost")
+	if ok || !strings.Contains(output, tagNotExists) {
+		t.Errorf("expected Run to write the error to its output and fail, got ok=%v:\n%s", ok, output)
+	}
+}
+
+func TestShowtagdefAllTagAnyPosition(t *testing.T) {
+	ctx := context.Background()
+	store := manage.NewMemoryStore()
+	for _, tagdef := range []*accounts.MrPlotterTagDef{
+		{Tag: "foo", PathPrefix: map[string]struct{}{"/foo/": struct{}{}}},
+		{Tag: "bar", PathPrefix: map[string]struct{}{"/bar/": struct{}{}}},
+	} {
+		if err := store.UpsertTagDef(ctx, tagdef); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output, ok := runCommand(t, store, "showtagdef", "foo", accounts.AllTag, "bar")
+	if !ok {
+		t.Fatalf("showtagdef failed:\n%s", output)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a line for each tag, got:\n%s", output)
+	}
+	if !strings.HasPrefix(lines[0], "foo") || !strings.Contains(lines[0], "/foo/") {
+		t.Errorf("expected foo's prefixes first, got: %s", lines[0])
+	}
+	if lines[1] != accounts.AllTag+": [ALL STREAMS]" {
+		t.Errorf("expected the all tag to be special-cased in the middle, got: %s", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "bar") || !strings.Contains(lines[2], "/bar/") {
+		t.Errorf("expected bar's prefixes last, got: %s", lines[2])
+	}
+}
+
+// countingStore counts the reads of tag definitions made through it.
+type countingStore struct {
+	manage.Store
+	tagDefReads int
+}
+
+func (cs *countingStore) RetrieveTagDef(ctx context.Context, tag string) (*accounts.MrPlotterTagDef, error) {
+	cs.tagDefReads++
+	return cs.Store.RetrieveTagDef(ctx, tag)
+}
+
+func (cs *countingStore) RetrieveMultipleTagDefs(ctx context.Context, prefix string) ([]*accounts.MrPlotterTagDef, error) {
+	cs.tagDefReads++
+	return cs.Store.RetrieveMultipleTagDefs(ctx, prefix)
+}
+
+// BenchmarkLsconfSharedTags measures lsconf over many accounts that share a
+// few tags, reporting how many tag definition reads each run makes.
+func BenchmarkLsconfSharedTags(b *testing.B) {
+	ctx := context.Background()
+	store := &countingStore{Store: manage.NewMemoryStore()}
+	tags := []string{"staff", "students", "visitors"}
+	for _, tag := range tags {
+		err := store.UpsertTagDef(ctx, &accounts.MrPlotterTagDef{Tag: tag, PathPrefix: map[string]struct{}{"/" + tag + "/": struct{}{}}})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	for i := 0; i != 1000; i++ {
+		acc := &accounts.MrPlotterAccount{Username: fmt.Sprintf("user%d", i), Tags: sliceToSet(tags)}
+		if err := store.UpsertAccount(ctx, acc); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	mpcli := NewMrPlotterCLIModule(nil)
+	mpcli.SetStore(store)
+	var lsconf admincli.CLIModule
+	for _, cmd := range mpcli.Children() {
+		if cmd.Name() == "lsconf" {
+			lsconf = cmd
+		}
+	}
+	store.tagDefReads = 0
+	b.ResetTimer()
+	for i := 0; i != b.N; i++ {
+		var output bytes.Buffer
+		if !lsconf.Run(ctx, &output) || mpcli.Failed() {
+			b.Fatalf("lsconf failed:\n%s", output.String())
+		}
+	}
+	b.ReportMetric(float64(store.tagDefReads)/float64(b.N), "tagreads/op")
+}
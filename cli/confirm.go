@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+)
+
+// SetInteractive controls whether commands may ask the operator to confirm
+// dangerous operations. When it is false, such operations must be confirmed
+// up front with an option such as --force.
+func (mpcli *MrPlotterCLIModule) SetInteractive(interactive bool) {
+	mpcli.interactive = interactive
+}
+
+// confirm asks the operator a yes-or-no question, returning true only if they
+// answer yes. It always returns false when not interactive.
+func (mpcli *MrPlotterCLIModule) confirm(output io.Writer, question string) bool {
+	if !mpcli.interactive {
+		return false
+	}
+	writeStringf(mpcli.warnWriter(output), "%s [y/N] ", question)
+	if !mpcli.input.Scan() {
+		writeStringln(mpcli.warnWriter(output), "")
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(mpcli.input.Text()))
+	return answer == "y" || answer == "yes"
+}
+
+// isTerminal returns true if output is a terminal, rather than a pipe, a
+// file, or some other writer.
+func isTerminal(output io.Writer) bool {
+	file, ok := output.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmShowHash returns true if output is a terminal, or if the operator
+// confirms writing password hashes to wherever it goes.
+func (mpcli *MrPlotterCLIModule) confirmShowHash(output io.Writer) bool {
+	if isTerminal(output) {
+		return true
+	}
+	writeStringln(mpcli.warnWriter(output), "WARNING: output is not a terminal, so password hashes may be saved or passed to another program")
+	if mpcli.confirm(output, "Show them anyway?") {
+		return true
+	}
+	writeStringln(mpcli.errWriter(output), "Not showing password hashes (use --force to show them without confirmation)")
+	return false
+}
+
+// confirmOverwritePassword returns true if the operator confirms replacing
+// the password of the account.
+func (mpcli *MrPlotterCLIModule) confirmOverwritePassword(output io.Writer, username string) bool {
+	if mpcli.confirm(output, fmt.Sprintf("Overwrite password for '%s'?", username)) {
+		return true
+	}
+	writeStringln(mpcli.errWriter(output), "Not changing the password (use --yes to change it without confirmation)")
+	return false
+}
+
+// confirmDeletion lists the names of the records that a command is about to
+// delete, and returns true if the operator confirms deleting them or yes is
+// set. If yes is set, the list is still written, to the error output, so that
+// it is kept with the output of scripts.
+func (mpcli *MrPlotterCLIModule) confirmDeletion(output io.Writer, kind string, names []string, yes bool) bool {
+	sorted := make([]string, len(names))
+	copy(sorted, names)
+	sort.Strings(sorted)
+	if yes || mpcli.interactive {
+		writeStringf(mpcli.warnWriter(output), "Matched %d %s:\n", len(sorted), kind)
+		for _, name := range sorted {
+			writeStringf(mpcli.warnWriter(output), "    %s\n", name)
+		}
+	}
+	if yes || mpcli.confirm(output, fmt.Sprintf("Delete these %d %s?", len(sorted), kind)) {
+		return true
+	}
+	writeStringf(mpcli.errWriter(output), "Not deleting any %s (use --yes to delete them without confirmation)\n", kind)
+	return false
+}
+
+// confirmAllTagToken is confirmAllTag for when granting the "all" tag
+// requires a confirmation token.
+func (mpcli *MrPlotterCLIModule) confirmAllTagToken(output io.Writer, username string, tags []string, understood bool) bool {
+	for _, tag := range tags {
+		if tag != accounts.AllTag {
+			continue
+		}
+		writeStringf(mpcli.warnWriter(output), "WARNING: the \"%s\" tag grants %s permission to view EVERY stream\n", accounts.AllTag, username)
+		return mpcli.confirmToken(output, fmt.Sprintf("grant the \"%s\" tag", accounts.AllTag), understood)
+	}
+	return true
+}
+
+// confirmAllTag returns true if the tags do not include the "all" tag, or if
+// the operator confirms granting it to the user.
+func (mpcli *MrPlotterCLIModule) confirmAllTag(output io.Writer, username string, tags []string) bool {
+	for _, tag := range tags {
+		if tag != accounts.AllTag {
+			continue
+		}
+		writeStringf(mpcli.warnWriter(output), "WARNING: the \"%s\" tag grants %s permission to view EVERY stream\n", accounts.AllTag, username)
+		if mpcli.confirm(output, "Grant it anyway?") {
+			return true
+		}
+		writeStringf(mpcli.errWriter(output), "Not granting the \"%s\" tag (use --force to grant it without confirmation)\n", accounts.AllTag)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// storeWithPrefix returns a store for the configuration with the given
+// prefix, which in dry-run mode reports writes to output instead.
+func (mpcli *MrPlotterCLIModule) storeWithPrefix(output io.Writer, prefix string) manage.Store {
+	store := manage.NewEtcdStoreWithPrefix(mpcli.ecl, prefix)
+	if mpcli.dryRun {
+		store = manage.NewDryRunStore(store, func(change string) {
+			writeStringln(output, change)
+		})
+	}
+	return store
+}
+
+func (mpcli *MrPlotterCLIModule) copyConfigCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "copyconfig",
+		usageargs:   "[--overwrite] srcprefix dstprefix",
+		hint:        "copies the accounts and tag definitions of the configuration with one etcd key prefix to the configuration with another, skipping those that already exist there unless --overwrite is given",
+		mutates:     true,
+		destructive: true,
+		previewable: true,
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			tokens, overwrite := extractFlag(tokens, "--overwrite")
+			if argsOK = len(tokens) == 2 && tokens[0] != tokens[1]; !argsOK {
+				return
+			}
+			dump, err := manage.ExportDump(ctx, mpcli.storeWithPrefix(output, tokens[0]))
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+
+			dst := mpcli.storeWithPrefix(output, tokens[1])
+			total := len(dump.TagDefs) + len(dump.Accounts)
+			var tagdefs, accs, skipped int
+			defer func() {
+				writeStringf(mpcli.infoWriter(output), "Copied %d tag definitions and %d accounts, skipped %d that already existed\n", tagdefs, accs, skipped)
+			}()
+			/* Define tags before granting them. */
+			for _, dt := range dump.TagDefs {
+				if !mpcli.pause(ctx, output, tagdefs+skipped, total) {
+					return
+				}
+				if !overwrite {
+					existing, err := dst.RetrieveTagDef(ctx, dt.Tag)
+					if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+						return
+					}
+					if existing != nil {
+						skipped++
+						continue
+					}
+				}
+				err = dst.UpsertTagDef(ctx, dt.TagDef())
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				tagdefs++
+			}
+			for _, da := range dump.Accounts {
+				if !mpcli.pause(ctx, output, tagdefs+accs+skipped, total) {
+					return
+				}
+				if !overwrite {
+					existing, err := dst.RetrieveAccount(ctx, da.Username)
+					if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+						return
+					}
+					if existing != nil {
+						skipped++
+						continue
+					}
+				}
+				err = dst.UpsertAccount(ctx, da.Account())
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				accs++
+			}
+			return
+		},
+	}
+}
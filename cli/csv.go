@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+)
+
+// exportCSV writes a header row and then the accounts, in order of username,
+// as CSV. Each row holds a username and its tags joined by spaces, or if
+// pairs is set, a username and one of its tags.
+func (mpcli *MrPlotterCLIModule) exportCSV(ctx context.Context, writer io.Writer, pairs bool) (int, error) {
+	csvWriter := csv.NewWriter(writer)
+	header := []string{"username", "tags"}
+	if pairs {
+		header = []string{"username", "tag"}
+	}
+	if err := csvWriter.Write(header); err != nil {
+		return 0, err
+	}
+	exported := 0
+	err := mpcli.store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+		tags := sortedSlice(acc.Tags)
+		var err error
+		if pairs {
+			for _, tag := range tags {
+				if err = csvWriter.Write([]string{acc.Username, tag}); err != nil {
+					break
+				}
+			}
+		} else {
+			err = csvWriter.Write([]string{acc.Username, strings.Join(tags, " ")})
+		}
+		if err != nil {
+			return err
+		}
+		exported++
+		return nil
+	})
+	if err != nil {
+		return exported, err
+	}
+	csvWriter.Flush()
+	return exported, csvWriter.Error()
+}
+
+func (mpcli *MrPlotterCLIModule) exportCSVCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "export-csv",
+		usageargs: "[--pairs] file",
+		hint:      "writes the username and tags of every account to a CSV file for access reviews, with --pairs one row per username and tag",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			tokens, pairs := extractFlag(tokens, "--pairs")
+			if argsOK = len(tokens) == 1; !argsOK {
+				return
+			}
+			file, err := os.OpenFile(tokens[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			defer file.Close()
+			writer := bufio.NewWriter(file)
+			exported, err := mpcli.exportCSV(ctx, writer, pairs)
+			if err == nil {
+				err = writer.Flush()
+			}
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			writeStringf(mpcli.infoWriter(output), "Exported %d accounts\n", exported)
+			return
+		},
+	}
+}
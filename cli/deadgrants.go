@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+)
+
+// deadReason returns why a tag grants access to no collection at all, or ""
+// if it grants something.
+func (r *resolver) deadReason(tag string) (string, error) {
+	tagdef, err := r.tagDef(tag)
+	switch {
+	case err != nil:
+		return "", err
+	case tagdef == nil:
+		return "not defined", nil
+	case len(tagdef.PathPrefix) == 0:
+		return "has no prefixes", nil
+	}
+	return "", nil
+}
+
+func (mpcli *MrPlotterCLIModule) deadGrantsCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "deadgrants",
+		usageargs: "",
+		hint:      "lists tags held by accounts that grant access to nothing, and why",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 0; !argsOK {
+				return
+			}
+			r := mpcli.newResolver(ctx)
+			if err := r.preload(); err != nil {
+				writeStringf(mpcli.errWriter(output), "Could not retrieve tag information: %v\n", err)
+				return
+			}
+			reasons := make(map[string]string)
+			dead := 0
+			err := mpcli.store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+				tags := setToSlice(acc.Tags)
+				sort.Strings(tags)
+				for _, tag := range tags {
+					if tag == accounts.AllTag {
+						continue
+					}
+					reason, ok := reasons[tag]
+					if !ok {
+						var err error
+						if reason, err = r.deadReason(tag); err != nil {
+							return err
+						}
+						reasons[tag] = reason
+					}
+					/* Every account holds the public tag, defined or not. */
+					if reason == "" || (tag == accounts.PublicTag && reason == "not defined") {
+						continue
+					}
+					writeStringf(output, "%s: %s (%s)\n", acc.Username, tag, reason)
+					dead++
+				}
+				return nil
+			})
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if dead == 1 {
+				writeStringln(mpcli.infoWriter(output), "1 grant gives access to nothing")
+			} else {
+				writeStringf(mpcli.infoWriter(output), "%d grants give access to nothing\n", dead)
+			}
+			return
+		},
+	}
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// changeList formats added and removed elements as "+a +b -c".
+func changeList(added []string, removed []string, quote bool) []string {
+	changes := make([]string, 0, len(added)+len(removed))
+	for _, elem := range added {
+		if quote {
+			elem = fmt.Sprintf("%q", elem)
+		}
+		changes = append(changes, "+"+elem)
+	}
+	for _, elem := range removed {
+		if quote {
+			elem = fmt.Sprintf("%q", elem)
+		}
+		changes = append(changes, "-"+elem)
+	}
+	return changes
+}
+
+// writeNames writes a heading followed by an indented list, if it is not
+// empty.
+func writeNames(output io.Writer, heading string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	writeStringf(output, "%s (%d):\n", heading, len(names))
+	for _, name := range names {
+		writeStringf(output, "    %s\n", name)
+	}
+}
+
+// writeDumpDiff describes the differences between an old and a new dump,
+// naming them with oldName and newName.
+func writeDumpDiff(output io.Writer, dd *manage.DumpDiff, oldName string, newName string) {
+	if dd.Empty() {
+		writeStringln(output, "No differences")
+		return
+	}
+	writeNames(output, "Accounts only in "+newName, dd.AddedAccounts)
+	writeNames(output, "Accounts only in "+oldName, dd.RemovedAccounts)
+	modified := make([]string, 0, len(dd.ModifiedAccounts))
+	for _, ad := range dd.ModifiedAccounts {
+		changes := changeList(ad.AddedTags, ad.RemovedTags, false)
+		if ad.PasswordChanged {
+			changes = append(changes, "password differs")
+		}
+		modified = append(modified, fmt.Sprintf("%s: %s", ad.Username, strings.Join(changes, " ")))
+	}
+	writeNames(output, "Accounts that differ", modified)
+
+	writeNames(output, "Tag definitions only in "+newName, dd.AddedTagDefs)
+	writeNames(output, "Tag definitions only in "+oldName, dd.RemovedTagDefs)
+	modified = make([]string, 0, len(dd.ModifiedTagDefs))
+	for _, td := range dd.ModifiedTagDefs {
+		changes := changeList(td.AddedPrefixes, td.RemovedPrefixes, true)
+		modified = append(modified, fmt.Sprintf("%s: %s", td.Tag, strings.Join(changes, " ")))
+	}
+	writeNames(output, "Tag definitions that differ", modified)
+}
+
+// findDumpAccount returns the account with the given username in a dump, or
+// nil if there is none.
+func findDumpAccount(dump *manage.Dump, username string) *manage.DumpAccount {
+	for i := range dump.Accounts {
+		if dump.Accounts[i].Username == username {
+			return &dump.Accounts[i]
+		}
+	}
+	return nil
+}
+
+func (mpcli *MrPlotterCLIModule) diffUserCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "diffuser",
+		usageargs: "[--format json|yaml] username file",
+		hint:      "shows how an account's live tags differ from its tags in a file written by export",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			tokens, format, argsOK := extractOption(tokens, "--format")
+			if argsOK = argsOK && len(tokens) == 2; !argsOK {
+				return
+			}
+			username := tokens[0]
+			fileDump := &manage.Dump{}
+			err := decodeFileFormat(tokens[1], format, fileDump)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			acc, err := mpcli.store.RetrieveAccount(ctx, username)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			fileAcc := findDumpAccount(fileDump, username)
+
+			switch {
+			case acc == nil && fileAcc == nil:
+				writeStringf(mpcli.errWriter(output), "Account %s exists neither in etcd nor in %s\n", username, tokens[1])
+			case fileAcc == nil:
+				live := manage.NewDumpAccount(acc)
+				writeStringf(output, "Account %s is not in the file; it was created since, with tags: %s\n", username, strings.Join(live.Tags, " "))
+			case acc == nil:
+				writeStringf(output, "Account %s no longer exists in etcd; in the file it had tags: %s\n", username, strings.Join(fileAcc.Tags, " "))
+			default:
+				live := manage.NewDumpAccount(acc)
+				ad := manage.DiffAccounts(fileAcc, &live)
+				if len(ad.AddedTags) == 0 && len(ad.RemovedTags) == 0 {
+					writeStringln(output, "No differences in tags")
+				}
+				writeNames(output, "Tags added since the file", ad.AddedTags)
+				writeNames(output, "Tags removed since the file", ad.RemovedTags)
+				if ad.PasswordChanged {
+					writeStringln(output, "The password has changed since the file")
+				}
+			}
+			return
+		},
+	}
+}
+
+func (mpcli *MrPlotterCLIModule) diffConfigCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "diffconfig",
+		usageargs: "[--format json|yaml] file",
+		hint:      "shows how the live configuration differs from a file written by export, record by record; this is not a preview of import, which never deletes and normalizes tags (use import with --dry-run for that)",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			tokens, format, argsOK := extractOption(tokens, "--format")
+			if argsOK = argsOK && len(tokens) == 1; !argsOK {
+				return
+			}
+			fileDump := &manage.Dump{}
+			err := decodeFileFormat(tokens[0], format, fileDump)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			liveDump, err := manage.ExportDump(ctx, mpcli.store)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			writeDumpDiff(output, manage.DiffDumps(liveDump, fileDump), "live configuration", "file")
+			return
+		},
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// SetDryRun controls whether commands that change the configuration only
+// print the changes they would make. Commands that cannot be previewed are
+// refused while dry-run mode is set.
+func (mpcli *MrPlotterCLIModule) SetDryRun(dryRun bool) {
+	mpcli.dryRun = dryRun
+}
+
+// preview makes mpc run unwrapped in dry-run mode, against a store that
+// reports writes instead of performing them. Nothing is locked or recorded in
+// the audit log, since nothing changes.
+func (mpcli *MrPlotterCLIModule) preview(mpc *MrPlotterCommand, unwrapped func(ctx context.Context, output io.Writer, tokens ...string) bool) {
+	exec := mpc.exec
+	mpc.exec = func(ctx context.Context, output io.Writer, tokens ...string) bool {
+		if !mpcli.dryRun {
+			return exec(ctx, output, tokens...)
+		}
+		if !mpc.previewable {
+			writeStringf(mpcli.errWriter(output), "%s cannot be previewed; run it without --dry-run\n", mpc.name)
+			return true
+		}
+		store := mpcli.store
+		mpcli.store = manage.NewDryRunStore(store, func(change string) {
+			writeStringln(output, change)
+		})
+		defer func() {
+			mpcli.store = store
+		}()
+		return unwrapped(ctx, output, tokens...)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// tagDefProblems returns an error for each reason that a tag definition in a
+// dump could not be imported.
+func tagDefProblems(dt *manage.DumpTagDef) []error {
+	var problems []error
+	if dt.Tag == accounts.AllTag {
+		problems = append(problems, fmt.Errorf("the \"%s\" tag cannot be defined", accounts.AllTag))
+	}
+	if len(dt.Prefixes) == 0 {
+		problems = append(problems, fmt.Errorf("tag '%s' has no prefixes", dt.Tag))
+	}
+	return problems
+}
+
+// checkDump returns an error describing the first tag definition in the dump
+// that could not be imported.
+func checkDump(dump *manage.Dump) error {
+	for i := range dump.TagDefs {
+		if problems := tagDefProblems(&dump.TagDefs[i]); len(problems) != 0 {
+			return problems[0]
+		}
+	}
+	return nil
+}
+
+func (mpcli *MrPlotterCLIModule) exportCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "export",
+		usageargs: "[--format json|yaml | --stream] file",
+		hint:      "writes every account and tag definition to a JSON or YAML file (chosen by extension unless --format is given), or with --stream, to a file of JSON lines",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			tokens, stream := extractFlag(tokens, "--stream")
+			tokens, format, argsOK := extractOption(tokens, "--format")
+			if argsOK = argsOK && len(tokens) == 1 && !(stream && len(format) != 0); !argsOK {
+				return
+			}
+			if stream {
+				accs, tagdefs, err := exportStreamFile(ctx, mpcli.store, tokens[0])
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				writeStringf(mpcli.infoWriter(output), "Exported %d accounts and %d tag definitions\n", accs, tagdefs)
+				return
+			}
+			dump, err := manage.ExportDump(ctx, mpcli.store)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			err = encodeFile(tokens[0], format, dump)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			writeStringf(mpcli.infoWriter(output), "Exported %d accounts and %d tag definitions\n", len(dump.Accounts), len(dump.TagDefs))
+			return
+		},
+	}
+}
+
+func (mpcli *MrPlotterCLIModule) importCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "import",
+		usageargs:   "[--format json|yaml] file",
+		hint:        "creates or overwrites the accounts and tag definitions in a file written by export, with or without --stream; others are left alone",
+		mutates:     true,
+		destructive: true,
+		previewable: true,
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			tokens, format, argsOK := extractOption(tokens, "--format")
+			if argsOK = argsOK && len(tokens) == 1; !argsOK {
+				return
+			}
+			stream, err := isStreamFile(tokens[0], format)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if stream {
+				mpcli.importStream(ctx, output, tokens[0])
+				return
+			}
+			dump := &manage.Dump{}
+			err = decodeFileFormat(tokens[0], format, dump)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if waserr, _ := writeError(mpcli.errWriter(output), checkDump(dump)); waserr {
+				return
+			}
+
+			/* Define tags before granting them. */
+			total := len(dump.TagDefs) + len(dump.Accounts)
+			var tagdefs, accs int
+			defer func() {
+				writeStringf(mpcli.infoWriter(output), "Imported %d tag definitions and %d accounts\n", tagdefs, accs)
+			}()
+			for _, dt := range dump.TagDefs {
+				if !mpcli.pause(ctx, output, tagdefs, total) {
+					return
+				}
+				err = mpcli.store.UpsertTagDef(ctx, dt.TagDef())
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				tagdefs++
+			}
+			for _, da := range dump.Accounts {
+				if !mpcli.pause(ctx, output, tagdefs+accs, total) {
+					return
+				}
+				err = mpcli.store.UpsertAccount(ctx, da.Account())
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				accs++
+			}
+			return
+		},
+	}
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// SetCaseInsensitiveUsernames controls whether new usernames are lowercased
+// and rejected if they collide with an existing username that differs only by
+// case.
+func (mpcli *MrPlotterCLIModule) SetCaseInsensitiveUsernames(caseInsensitive bool) {
+	mpcli.foldCase = caseInsensitive
+}
+
+// groupByFoldedCase groups usernames that are equal when lowercased. Only
+// groups with more than one username are returned.
+func groupByFoldedCase(accs []*accounts.MrPlotterAccount) map[string][]string {
+	groups := make(map[string][]string)
+	for _, acc := range accs {
+		folded := strings.ToLower(acc.Username)
+		groups[folded] = append(groups[folded], acc.Username)
+	}
+	for folded, usernames := range groups {
+		if len(usernames) < 2 {
+			delete(groups, folded)
+		}
+	}
+	return groups
+}
+
+// foldedUsernames maps the lowercased form of each existing username to the
+// username itself. Commands that check several usernames for collisions
+// should build it once and add each account they create to it.
+func foldedUsernames(ctx context.Context, store manage.Store) (map[string]string, error) {
+	accs, err := store.RetrieveMultipleAccounts(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	folded := make(map[string]string, len(accs))
+	for _, acc := range accs {
+		folded[strings.ToLower(acc.Username)] = acc.Username
+	}
+	return folded, nil
+}
+
+// findCaseCollision returns the username of an existing account that differs
+// from username only by case, or the empty string if there is none.
+func findCaseCollision(folded map[string]string, username string) string {
+	return folded[strings.ToLower(username)]
+}
+
+func (mpcli *MrPlotterCLIModule) dupesCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "dupes",
+		usageargs: "",
+		hint:      "lists groups of usernames that differ only by case",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 0; !argsOK {
+				return
+			}
+			accs, err := mpcli.store.RetrieveMultipleAccounts(ctx, "")
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			groups := groupByFoldedCase(accs)
+			folded := make([]string, 0, len(groups))
+			for name := range groups {
+				folded = append(folded, name)
+			}
+			sort.Strings(folded)
+			for _, name := range folded {
+				usernames := groups[name]
+				sort.Strings(usernames)
+				writeStringf(output, "%s: %s\n", name, strings.Join(usernames, " "))
+			}
+			return
+		},
+	}
+}
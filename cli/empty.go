@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+)
+
+func (mpcli *MrPlotterCLIModule) emptyUsersCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "emptyusers",
+		usageargs: "",
+		hint:      "lists accounts whose tags grant no path prefixes at all, with the tags they hold",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 0; !argsOK {
+				return
+			}
+			r := mpcli.newResolver(ctx)
+			if err := r.preload(); err != nil {
+				writeStringf(mpcli.errWriter(output), "Could not retrieve tag information: %v\n", err)
+				return
+			}
+			empty := 0
+			err := mpcli.store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+				prefixes, err := r.prefixes(acc.Tags)
+				if err != nil {
+					return err
+				}
+				if len(prefixes) != 0 {
+					return nil
+				}
+				writeStringf(output, "%s: %s\n", acc.Username, strings.Join(sortedSlice(acc.Tags), " "))
+				empty++
+				return nil
+			})
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if empty == 1 {
+				writeStringln(mpcli.infoWriter(output), "1 account can see nothing")
+			} else {
+				writeStringf(mpcli.infoWriter(output), "%d accounts can see nothing\n", empty)
+			}
+			return
+		},
+	}
+}
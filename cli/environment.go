@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// SetEnvironment sets the label of the environment, such as "production",
+// whose configuration is being managed. If it is not empty, every destructive
+// command asks for confirmation before it runs, whatever its options, and is
+// refused when there is no one to ask.
+func (mpcli *MrPlotterCLIModule) SetEnvironment(environment string) {
+	mpcli.environment = environment
+}
+
+func (mpcli *MrPlotterCLIModule) guard(mpc *MrPlotterCommand) {
+	exec := mpc.exec
+	mpc.exec = func(ctx context.Context, output io.Writer, tokens ...string) bool {
+		if len(mpcli.environment) == 0 || !mpc.destructive || mpcli.dryRun {
+			return exec(ctx, output, tokens...)
+		}
+		writeStringf(mpcli.warnWriter(output), "WARNING: %s changes the %s configuration\n", mpc.name, mpcli.environment)
+		if !mpcli.confirm(output, fmt.Sprintf("Run it against %s?", mpcli.environment)) {
+			writeStringf(mpcli.errWriter(output), "Not running %s (destructive commands must be confirmed in the %s environment)\n", mpc.name, mpcli.environment)
+			return true
+		}
+		return exec(ctx, output, tokens...)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+)
+
+// explainTag writes the steps by which a tag grants access to the collection
+// or not, following the same rules as matchTag, and returns the prefix that
+// grants it and whether there is one.
+func (r *resolver) explainTag(output io.Writer, tag string, collection string) (string, bool, error) {
+	tagdef, err := r.tagDef(tag)
+	if err != nil {
+		return "", false, err
+	}
+	if tagdef == nil {
+		writeStringf(output, "    %s is not defined, so it grants nothing\n", tag)
+		return "", false, nil
+	}
+	writeStringf(output, "    %s has %d prefixes\n", tag, len(tagdef.PathPrefix))
+	pfx, ok, err := r.matchTag(tag, collection)
+	if err != nil || !ok {
+		writeStringf(output, "    no prefix of %s begins the path\n", tag)
+		return "", false, err
+	}
+	writeStringf(output, "    prefix %q of %s begins the path\n", pfx, tag)
+	return pfx, true, nil
+}
+
+func (mpcli *MrPlotterCLIModule) explainCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "explain",
+		usageargs: "username collection",
+		hint:      "shows step by step how it is decided whether a user may view the streams in a collection",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 2; !argsOK {
+				return
+			}
+			username, collection := tokens[0], tokens[1]
+			acc, err := mpcli.store.RetrieveAccount(ctx, username)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if acc == nil {
+				writeStringln(mpcli.errWriter(output), accountNotExists)
+				return
+			}
+			tags := sortedSlice(acc.Tags)
+			writeStringf(output, "%s holds %d tags: %s\n", username, len(tags), strings.Join(tags, " "))
+			if _, ok := acc.Tags[accounts.AllTag]; ok {
+				writeStringf(output, "The \"%s\" tag grants every stream, so no other tag is consulted\n", accounts.AllTag)
+				writeStringf(output, "Decision: allowed (granted by tag '%s')\n", accounts.AllTag)
+				return
+			}
+
+			r := mpcli.newResolver(ctx)
+			var granting []string
+			var grantedBy string
+			for _, tag := range tags {
+				writeStringf(output, "Checking tag %s:\n", tag)
+				pfx, ok, err := r.explainTag(output, tag, collection)
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				if ok {
+					writeStringf(output, "    => %s grants %s\n", tag, collection)
+					if len(granting) == 0 {
+						grantedBy = fmt.Sprintf("tag '%s' through prefix %q", tag, pfx)
+					}
+					granting = append(granting, tag)
+				} else {
+					writeStringf(output, "    => %s does not grant %s\n", tag, collection)
+				}
+			}
+			if len(granting) == 0 {
+				writeStringln(output, "Decision: denied (no tag grants the path)")
+			} else if len(granting) == 1 {
+				writeStringf(output, "Decision: allowed (granted by %s)\n", grantedBy)
+			} else {
+				writeStringf(output, "Decision: allowed (granted by %s, and also by %s)\n", grantedBy, strings.Join(granting[1:], ", "))
+			}
+
+			return
+		},
+	}
+}
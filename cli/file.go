@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// isYAMLPath returns true if the file's extension indicates YAML rather than
+// JSON.
+func isYAMLPath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// fileFormat returns "json" or "yaml": the format named by override if it is
+// not empty, and otherwise the format indicated by the file's extension.
+func fileFormat(path string, override string) (string, error) {
+	switch strings.ToLower(override) {
+	case "":
+		if isYAMLPath(path) {
+			return "yaml", nil
+		}
+		return "json", nil
+	case "json":
+		return "json", nil
+	case "yaml", "yml":
+		return "yaml", nil
+	}
+	return "", fmt.Errorf("unknown file format '%s' (expected json or yaml)", override)
+}
+
+// decodeFile reads a JSON or YAML file into v, choosing the format by the
+// file's extension.
+func decodeFile(path string, v interface{}) error {
+	return decodeFileFormat(path, "", v)
+}
+
+// decodeFileFormat reads a file into v in the given format, or if format is
+// empty, the format indicated by the file's extension.
+func decodeFileFormat(path string, format string, v interface{}) error {
+	format, err := fileFormat(path, format)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if format == "yaml" {
+		return yaml.Unmarshal(data, v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// encodeFile writes v to a file, readable only by its owner, in the given
+// format, or if format is empty, the format indicated by the file's
+// extension.
+func encodeFile(path string, format string, v interface{}) error {
+	format, err := fileFormat(path, format)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if format == "yaml" {
+		data, err = yaml.Marshal(v)
+	} else {
+		data, err = json.MarshalIndent(v, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
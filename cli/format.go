@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+)
+
+// accountRecord is the context in which --format templates are executed for
+// an account. PasswordHash is only set when showuser is given --show-hash.
+type accountRecord struct {
+	Username     string
+	Tags         []string
+	PasswordHash string
+}
+
+func newAccountRecord(acc *accounts.MrPlotterAccount) *accountRecord {
+	tags := setToSlice(acc.Tags)
+	sort.Strings(tags)
+	return &accountRecord{Username: acc.Username, Tags: tags}
+}
+
+// tagDefRecord is the context in which --format templates are executed for a
+// tag definition.
+type tagDefRecord struct {
+	Tag      string
+	Prefixes []string
+}
+
+func newTagDefRecord(tagdef *accounts.MrPlotterTagDef) *tagDefRecord {
+	prefixes := setToSlice(tagdef.PathPrefix)
+	sort.Strings(prefixes)
+	return &tagDefRecord{Tag: tagdef.Tag, Prefixes: prefixes}
+}
+
+// newlineSeparator is the value of --sep that puts each element of a list on
+// its own line.
+const newlineSeparator = "newline"
+
+// extractSeparator removes the --sep option from tokens, returning the
+// separator that lists should be joined with. It is a space by default.
+func extractSeparator(tokens []string) ([]string, string, bool) {
+	remaining, sep, argsOK := extractOption(tokens, "--sep")
+	switch sep {
+	case "":
+		sep = " "
+	case newlineSeparator:
+		sep = "\n"
+	}
+	return remaining, sep, argsOK
+}
+
+// formatList formats a named list as "name: a b c", with the elements joined
+// by sep. If sep is a newline, each element is instead indented on its own
+// line after the name.
+func formatList(name string, elems []string, sep string) string {
+	if sep != "\n" {
+		return name + ": " + strings.Join(elems, sep)
+	}
+	lines := make([]string, 0, len(elems)+1)
+	lines = append(lines, name+":")
+	for _, elem := range elems {
+		lines = append(lines, "    "+elem)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseFormat removes the --format option from tokens and compiles its
+// template. The template is nil if the option was not given. If the template
+// does not compile, an error is written and ok is false.
+func (mpcli *MrPlotterCLIModule) parseFormat(output io.Writer, tokens []string) (remaining []string, tmpl *template.Template, argsOK bool, ok bool) {
+	remaining, format, argsOK := extractOption(tokens, "--format")
+	if !argsOK {
+		return
+	}
+	ok = true
+	if len(format) != 0 {
+		var err error
+		tmpl, err = template.New("format").Parse(format)
+		if err != nil {
+			writeStringf(mpcli.errWriter(output), "Invalid format template: %v\n", err)
+			ok = false
+		}
+	}
+	return
+}
+
+// writeTemplate writes a record formatted with the template, followed by a
+// newline.
+// errFormatFailed is returned by callbacks that stop because writeTemplate
+// failed, which has already reported the error.
+var errFormatFailed = errors.New("could not format record")
+
+func (mpcli *MrPlotterCLIModule) writeTemplate(output io.Writer, tmpl *template.Template, record interface{}) error {
+	if err := tmpl.Execute(output, record); err != nil {
+		writeStringf(mpcli.errWriter(output), "Could not format record: %v\n", err)
+		return err
+	}
+	return writeStringln(output, "")
+}
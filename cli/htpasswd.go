@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// exportHtpasswd writes a "username:hash" line for each account to the
+// writer. Accounts that cannot be used to log in, and those whose usernames
+// cannot be represented in the format, are reported as warnings and skipped.
+func (mpcli *MrPlotterCLIModule) exportHtpasswd(ctx context.Context, output io.Writer, writer io.Writer) (int, int, error) {
+	exported, skipped := 0, 0
+	err := mpcli.store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+		reason := ""
+		switch {
+		case manage.IsLocked(acc):
+			reason = "it is locked"
+		case len(acc.PasswordHash) == 0:
+			reason = "it has no password"
+		case strings.ContainsAny(acc.Username, ":\n"):
+			reason = "its username contains ':' or a newline"
+		}
+		if reason != "" {
+			writeStringf(mpcli.warnWriter(output), "Skipped %s: %s\n", acc.Username, reason)
+			skipped++
+			return nil
+		}
+		if _, err := io.WriteString(writer, acc.Username+":"+string(acc.PasswordHash)+"\n"); err != nil {
+			return err
+		}
+		exported++
+		return nil
+	})
+	return exported, skipped, err
+}
+
+func (mpcli *MrPlotterCLIModule) exportHtpasswdCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "export-htpasswd",
+		usageargs: "file",
+		hint:      "writes the username and bcrypt password hash of every account to a file in htpasswd format, skipping locked accounts",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 1; !argsOK {
+				return
+			}
+			file, err := os.OpenFile(tokens[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			defer file.Close()
+			writer := bufio.NewWriter(file)
+			exported, skipped, err := mpcli.exportHtpasswd(ctx, output, writer)
+			if err == nil {
+				err = writer.Flush()
+			}
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			writeStringf(mpcli.infoWriter(output), "Exported %d accounts (%d skipped)\n", exported, skipped)
+			return
+		},
+	}
+}
+
+// htpasswdEntry is one account read from an htpasswd file.
+type htpasswdEntry struct {
+	line     int
+	username string
+	hash     string
+}
+
+// readHtpasswd reads the entries of an htpasswd file. Blank lines and lines
+// beginning with "#" are skipped; lines without a ":" are reported and
+// skipped.
+func (mpcli *MrPlotterCLIModule) readHtpasswd(output io.Writer, path string) ([]htpasswdEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []htpasswdEntry
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		sep := strings.IndexByte(text, ':')
+		if sep <= 0 {
+			writeStringf(mpcli.errWriter(output), "%s:%d: expected \"username:hash\"\n", path, line)
+			continue
+		}
+		entries = append(entries, htpasswdEntry{line: line, username: text[:sep], hash: text[sep+1:]})
+	}
+	return entries, scanner.Err()
+}
+
+func (mpcli *MrPlotterCLIModule) importHtpasswdCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "import-htpasswd",
+		usageargs:   "file [tag1] [tag2] ...",
+		hint:        fmt.Sprintf("creates an account for each user in an htpasswd file of bcrypt hashes, keeping their passwords, with the given tags and \"%s\"", accounts.PublicTag),
+		mutates:     true,
+		previewable: true,
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) >= 1; !argsOK {
+				return
+			}
+			path := tokens[0]
+			entries, err := mpcli.readHtpasswd(output, path)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			var folded map[string]string
+			if mpcli.foldCase {
+				folded, err = foldedUsernames(ctx, mpcli.store)
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+			}
+			imported := 0
+			for i, entry := range entries {
+				if !mpcli.pause(ctx, output, i, len(entries)) {
+					break
+				}
+				username := entry.username
+				if mpcli.foldCase {
+					username = strings.ToLower(username)
+					if existing := findCaseCollision(folded, username); existing != "" {
+						writeStringf(mpcli.errWriter(output), "%s:%d: %s (conflicts with '%s')\n", path, entry.line, alreadyExists, existing)
+						continue
+					}
+				}
+				err = manage.AddUserWithHash(ctx, mpcli.store, username, entry.hash, tokens[1:])
+				if err != nil {
+					writeStringf(mpcli.errWriter(output), "%s:%d: %s: ", path, entry.line, username)
+					writeManageError(mpcli.errWriter(output), err)
+					continue
+				}
+				if folded != nil {
+					folded[username] = username
+				}
+				imported++
+			}
+			writeStringf(mpcli.infoWriter(output), "Imported %d of %d accounts\n", imported, len(entries))
+			return
+		},
+	}
+}
+
+func (mpcli *MrPlotterCLIModule) setHashCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "sethash",
+		usageargs:   "[--yes] username bcrypthash",
+		hint:        "sets a user's password hash to an existing bcrypt hash, as when migrating the account, after confirmation unless --yes is given",
+		mutates:     true,
+		destructive: true,
+		previewable: true,
+		secretargs:  []int{1},
+		flags:       []string{"--yes"},
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			tokens, yes := extractFlag(tokens, "--yes")
+			if argsOK = len(tokens) == 2; !argsOK {
+				return
+			}
+			/* Check the hash first, so that a bad one is not confirmed. */
+			if writeManageError(mpcli.errWriter(output), manage.ValidateHash(tokens[1])) {
+				return
+			}
+			if !yes && !mpcli.confirmOverwritePassword(output, tokens[0]) {
+				return
+			}
+			err := manage.SetPasswordHash(ctx, mpcli.store, tokens[0], tokens[1])
+			writeManageError(mpcli.errWriter(output), err)
+			return
+		},
+	}
+}
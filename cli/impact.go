@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+)
+
+// countHolders returns the number of accounts that hold a tag.
+func (mpcli *MrPlotterCLIModule) countHolders(ctx context.Context, tag string) (int, error) {
+	holders := 0
+	err := mpcli.store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+		if _, ok := acc.Tags[tag]; ok {
+			holders++
+		}
+		return nil
+	})
+	return holders, err
+}
+
+// writeImpact reports how many accounts gain or lose the given prefixes of a
+// tag, as verb describes.
+func (mpcli *MrPlotterCLIModule) writeImpact(ctx context.Context, output io.Writer, tag string, verb string, prefixes []string) {
+	if len(prefixes) == 0 {
+		writeStringln(output, "This affects no users: the tag definition did not change")
+		return
+	}
+	holders, err := mpcli.countHolders(ctx, tag)
+	if err != nil {
+		writeStringf(mpcli.errWriter(output), "Could not count the users holding %s: %v\n", tag, err)
+		return
+	}
+	quoted := make([]string, len(prefixes))
+	for i, pfx := range prefixes {
+		quoted[i] = fmt.Sprintf("%q", pfx)
+	}
+	if holders == 1 {
+		writeStringf(output, "This affects 1 user, who %s: %s\n", verb, strings.Join(quoted, " "))
+	} else {
+		writeStringf(output, "This affects %d users, who %s: %s\n", holders, verb, strings.Join(quoted, " "))
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+)
+
+func (mpcli *MrPlotterCLIModule) importTagsCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "importtags",
+		usageargs:   "file",
+		hint:        "defines or redefines tags from a JSON or YAML file mapping each tag to a list of path prefixes",
+		mutates:     true,
+		previewable: true,
+		destructive: true,
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 1; !argsOK {
+				return
+			}
+			var tagPrefixes map[string][]string
+			err := decodeFile(tokens[0], &tagPrefixes)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+
+			tags := make([]string, 0, len(tagPrefixes))
+			for tag := range tagPrefixes {
+				tags = append(tags, tag)
+			}
+			sort.Strings(tags)
+
+			var created, updated, skipped int
+			for i, tag := range tags {
+				if tag == accounts.AllTag {
+					writeStringf(mpcli.warnWriter(output), "Warning: skipping the \"%s\" tag, which cannot be defined\n", accounts.AllTag)
+					skipped++
+					continue
+				}
+				prefixes := tagPrefixes[tag]
+				if len(prefixes) == 0 {
+					writeStringf(mpcli.warnWriter(output), "Warning: skipping tag '%s', which has no prefixes\n", tag)
+					skipped++
+					continue
+				}
+				existing, err := mpcli.store.RetrieveTagDef(ctx, tag)
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					break
+				}
+				prefixes = mpcli.checkPrefixes(output, prefixes)
+				tagdef := &accounts.MrPlotterTagDef{Tag: tag, PathPrefix: sliceToSet(prefixes)}
+				if !mpcli.pause(ctx, output, i, len(tags)) {
+					break
+				}
+				err = mpcli.store.UpsertTagDef(ctx, tagdef)
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					break
+				}
+				if existing == nil {
+					created++
+				} else {
+					updated++
+				}
+			}
+			writeStringf(mpcli.infoWriter(output), "Created %d tag definitions, updated %d already existing, skipped %d\n", created, updated, skipped)
+			return
+		},
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+)
+
+// SetLimits sets the most tags that grant may leave an account with, and the
+// most prefixes that addprefix may leave a tag definition with, unless
+// --force is given. Zero means no limit.
+func (mpcli *MrPlotterCLIModule) SetLimits(maxTags int, maxPrefixes int) {
+	mpcli.maxTags = maxTags
+	mpcli.maxPrefixes = maxPrefixes
+}
+
+// unionSize returns the number of elements in the union of a set and a list.
+func unionSize(set map[string]struct{}, added []string) int {
+	n := len(set)
+	seen := make(map[string]struct{}, len(added))
+	for _, elem := range added {
+		if _, ok := set[elem]; ok {
+			continue
+		}
+		if _, ok := seen[elem]; !ok {
+			seen[elem] = struct{}{}
+			n++
+		}
+	}
+	return n
+}
+
+// checkTagLimit returns true if granting the tags would leave the account
+// within the tag limit. Missing accounts are left for the grant to report.
+func (mpcli *MrPlotterCLIModule) checkTagLimit(ctx context.Context, output io.Writer, username string, tags []string) bool {
+	if mpcli.maxTags <= 0 {
+		return true
+	}
+	acc, err := mpcli.store.RetrieveAccount(ctx, username)
+	if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+		return false
+	}
+	if acc == nil {
+		return true
+	}
+	if n := unionSize(acc.Tags, tags); n > mpcli.maxTags {
+		writeStringf(mpcli.errWriter(output), "Not granting: %s has %d tags, and would have %d, more than the limit of %d (use --force to exceed it)\n", username, len(acc.Tags), n, mpcli.maxTags)
+		return false
+	}
+	return true
+}
+
+// checkPrefixLimit returns true if adding the prefixes would leave the tag
+// definition within the prefix limit. Undefined tags are left for addprefix
+// to report.
+func (mpcli *MrPlotterCLIModule) checkPrefixLimit(ctx context.Context, output io.Writer, tag string, prefixes []string) bool {
+	if mpcli.maxPrefixes <= 0 {
+		return true
+	}
+	tagdef, err := mpcli.store.RetrieveTagDef(ctx, tag)
+	if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+		return false
+	}
+	if tagdef == nil {
+		return true
+	}
+	if n := unionSize(tagdef.PathPrefix, prefixes); n > mpcli.maxPrefixes {
+		writeStringf(mpcli.errWriter(output), "Not adding: %s has %d prefixes, and would have %d, more than the limit of %d (use --force to exceed it)\n", tag, len(tagdef.PathPrefix), n, mpcli.maxPrefixes)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+
+	"github.com/samkumar/mr-plotter-conf/meta"
+)
+
+// SetLocking controls whether commands that change the configuration first
+// acquire a lock in etcd, so that concurrent administrators do not interleave
+// their changes.
+func (mpcli *MrPlotterCLIModule) SetLocking(locking bool) {
+	mpcli.locking = locking
+}
+
+func (mpcli *MrPlotterCLIModule) lock(mpc *MrPlotterCommand) {
+	exec := mpc.exec
+	mpc.exec = func(ctx context.Context, output io.Writer, tokens ...string) bool {
+		if !mpcli.locking {
+			return exec(ctx, output, tokens...)
+		}
+		unlock, err := meta.LockConfig(ctx, mpcli.ecl, func() {
+			writeStringln(mpcli.warnWriter(output), "waiting for config lock...")
+		})
+		if err != nil {
+			writeStringf(mpcli.errWriter(output), "Could not acquire config lock: %v\n", err)
+			return true
+		}
+		defer func() {
+			if err := unlock(); err != nil {
+				writeStringf(mpcli.warnWriter(output), "Warning: could not release config lock: %v\n", err)
+			}
+		}()
+		return exec(ctx, output, tokens...)
+	}
+}
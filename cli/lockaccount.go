@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+func (mpcli *MrPlotterCLIModule) lockAccountCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "lockaccount",
+		usageargs:   "username",
+		hint:        "discards a user's password, so that no password works until unlockaccount sets a new one",
+		mutates:     true,
+		previewable: true,
+		destructive: true,
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 1; !argsOK {
+				return
+			}
+			locked, err := manage.LockAccount(ctx, mpcli.store, tokens[0])
+			if writeManageError(mpcli.errWriter(output), err) {
+				return
+			}
+			if !locked {
+				writeStringf(mpcli.infoWriter(output), "%s is already locked\n", tokens[0])
+			}
+			return
+		},
+	}
+}
+
+func (mpcli *MrPlotterCLIModule) unlockAccountCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "unlockaccount",
+		usageargs:   "username password",
+		hint:        "gives a locked user a new password",
+		mutates:     true,
+		previewable: true,
+		secretargs:  []int{1},
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 2; !argsOK {
+				return
+			}
+			err := manage.UnlockAccount(ctx, mpcli.store, tokens[0], tokens[1])
+			writeManageError(mpcli.errWriter(output), err)
+			return
+		},
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+)
+
+func (mpcli *MrPlotterCLIModule) canCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "can",
+		usageargs: "username collection",
+		hint:      "checks whether a user may view the streams in a collection",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 2; !argsOK {
+				return
+			}
+			acc, err := mpcli.store.RetrieveAccount(ctx, tokens[0])
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if acc == nil {
+				writeStringln(mpcli.errWriter(output), accountNotExists)
+				return
+			}
+			r := mpcli.newResolver(ctx)
+			tag, ok, err := r.matchTags(acc.Tags, tokens[1])
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if ok {
+				writeStringf(output, "yes (granted by tag '%s')\n", tag)
+			} else {
+				writeStringln(output, "no")
+			}
+			return
+		},
+	}
+}
+
+func (mpcli *MrPlotterCLIModule) tagsForCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "tagsfor",
+		usageargs: "prefix",
+		hint:      "lists every tag that grants access to a path prefix, with the entry that covers it",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 1; !argsOK {
+				return
+			}
+			r := mpcli.newResolver(ctx)
+			if err := r.preload(); err != nil {
+				writeStringf(mpcli.errWriter(output), "Could not retrieve tag information: %v\n", err)
+				return
+			}
+			tags := make([]string, 0, len(r.tagdefs))
+			for tag := range r.tagdefs {
+				tags = append(tags, tag)
+			}
+			sort.Strings(tags)
+
+			writeStringf(output, "%s: [ALL STREAMS]\n", accounts.AllTag)
+			for _, tag := range tags {
+				entry, ok, err := r.matchTag(tag, tokens[0])
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				if ok {
+					writeStringf(output, "%s: %q\n", tag, entry)
+				}
+			}
+			return
+		},
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/samkumar/mr-plotter-conf/logging"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// configMetrics are the statistics about the configuration that are exposed
+// to Prometheus.
+type configMetrics struct {
+	accounts        int
+	tagDefs         int
+	allTagAccounts  int
+	corruptAccounts int
+	corruptTagDefs  int
+}
+
+// collectMetrics computes the statistics from the configuration in the
+// store.
+func collectMetrics(ctx context.Context, store manage.Store) (*configMetrics, error) {
+	m := &configMetrics{}
+	tagdefs, err := store.RetrieveMultipleTagDefs(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	m.tagDefs = len(tagdefs)
+	for _, tagdef := range tagdefs {
+		if tagdef.PathPrefix == nil {
+			m.corruptTagDefs++
+		}
+	}
+	err = store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+		m.accounts++
+		if acc.Tags == nil {
+			m.corruptAccounts++
+		} else if _, ok := acc.Tags[accounts.AllTag]; ok {
+			m.allTagAccounts++
+		}
+		return nil
+	})
+	return m, err
+}
+
+// writeGauge writes a gauge in the Prometheus text exposition format.
+func writeGauge(buf *bytes.Buffer, name string, help string, value interface{}) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+}
+
+// MetricsHandler returns an HTTP handler that serves statistics about the
+// configuration to Prometheus. Each scrape reads the whole configuration at a
+// single etcd revision.
+func (mpcli *MrPlotterCLIModule) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		store, _, err := manage.NewSnapshotStore(r.Context(), mpcli.ecl)
+		var m *configMetrics
+		if err == nil {
+			m, err = collectMetrics(r.Context(), store)
+		}
+		if err != nil {
+			logging.Errorf("Could not collect metrics: %v", err)
+			http.Error(w, fmt.Sprintf("could not read the configuration: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		var buf bytes.Buffer
+		writeGauge(&buf, "mrplotter_conf_accounts", "Number of user accounts, including corrupt ones.", m.accounts)
+		writeGauge(&buf, "mrplotter_conf_tag_definitions", "Number of tag definitions, including corrupt ones.", m.tagDefs)
+		writeGauge(&buf, "mrplotter_conf_all_tag_accounts", "Number of accounts holding the \"all\" tag.", m.allTagAccounts)
+		writeGauge(&buf, "mrplotter_conf_corrupt_accounts", "Number of accounts that could not be decoded.", m.corruptAccounts)
+		writeGauge(&buf, "mrplotter_conf_corrupt_tag_definitions", "Number of tag definitions that could not be decoded.", m.corruptTagDefs)
+		writeGauge(&buf, "mrplotter_conf_scrape_duration_seconds", "Time taken to read the configuration for this scrape.", time.Since(start).Seconds())
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes())
+	})
+}
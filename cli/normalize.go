@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// redundantPrefixes returns the prefixes of a tag definition that begin with
+// another of its prefixes, and so grant nothing more.
+func redundantPrefixes(tagdef *accounts.MrPlotterTagDef) []string {
+	var redundant []string
+	for pfx := range tagdef.PathPrefix {
+		for other := range tagdef.PathPrefix {
+			if other != pfx && strings.HasPrefix(pfx, other) {
+				redundant = append(redundant, pfx)
+				break
+			}
+		}
+	}
+	sort.Strings(redundant)
+	return redundant
+}
+
+func (mpcli *MrPlotterCLIModule) normalizeCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "normalize",
+		usageargs:   "",
+		hint:        "removes redundant prefixes from tag definitions, revokes undefined tags, and grants the \"public\" tag to accounts missing it, in one pass (use --dry-run to see what would change)",
+		mutates:     true,
+		previewable: true,
+		destructive: true,
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 0; !argsOK {
+				return
+			}
+			tagdefs, err := mpcli.store.RetrieveMultipleTagDefs(ctx, "")
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			accs, err := mpcli.store.RetrieveMultipleAccounts(ctx, "")
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+
+			var simplified, removedPrefixes, pruned, prunedTags, publicGranted, corrupt int
+			defer func() {
+				writeStringf(mpcli.infoWriter(output), "Removed %d redundant prefixes from %d tag definitions\n", removedPrefixes, simplified)
+				writeStringf(mpcli.infoWriter(output), "Revoked %d undefined tags from %d accounts\n", prunedTags, pruned)
+				writeStringf(mpcli.infoWriter(output), "Granted the \"%s\" tag to %d accounts\n", accounts.PublicTag, publicGranted)
+				if corrupt != 0 {
+					writeStringf(mpcli.warnWriter(output), "Left %d corrupt entries, which must be fixed or deleted by hand\n", corrupt)
+				}
+			}()
+
+			total := len(tagdefs) + len(accs)
+			defined := map[string]struct{}{accounts.AllTag: {}, accounts.PublicTag: {}}
+			for i, tagdef := range tagdefs {
+				defined[tagdef.Tag] = struct{}{}
+				if tagdef.PathPrefix == nil {
+					writeStringf(mpcli.warnWriter(output), "Tag definition %s is corrupt\n", tagdef.Tag)
+					corrupt++
+					continue
+				}
+				redundant := redundantPrefixes(tagdef)
+				if len(redundant) == 0 {
+					continue
+				}
+				if !mpcli.pause(ctx, output, i, total) {
+					return
+				}
+				removed, err := manage.RemovePrefixes(ctx, mpcli.store, tagdef.Tag, redundant)
+				if writeManageError(mpcli.errWriter(output), err) {
+					return
+				}
+				removedPrefixes += len(removed)
+				simplified++
+			}
+
+			for i, acc := range accs {
+				if acc.Tags == nil {
+					writeStringf(mpcli.warnWriter(output), "Account %s is corrupt\n", acc.Username)
+					corrupt++
+					continue
+				}
+				var undefined []string
+				for tag := range acc.Tags {
+					if _, ok := defined[tag]; !ok {
+						undefined = append(undefined, tag)
+					}
+				}
+				sort.Strings(undefined)
+				_, hasPublic := acc.Tags[accounts.PublicTag]
+				if len(undefined) == 0 && hasPublic {
+					continue
+				}
+				if !mpcli.pause(ctx, output, len(tagdefs)+i, total) {
+					return
+				}
+				/* Every write adds the public tag, so revoking adds it too. */
+				var revoked []string
+				if len(undefined) == 0 {
+					_, err = manage.GrantTags(ctx, mpcli.store, acc.Username, []string{accounts.PublicTag})
+				} else {
+					revoked, err = manage.RevokeTags(ctx, mpcli.store, acc.Username, undefined)
+				}
+				if writeManageError(mpcli.errWriter(output), err) {
+					return
+				}
+				if len(revoked) != 0 {
+					prunedTags += len(revoked)
+					pruned++
+				}
+				if !hasPublic {
+					publicGranted++
+				}
+			}
+			return
+		},
+	}
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// passwordEnvOption names an environment variable from which to read a
+// password, instead of giving it as an argument.
+const passwordEnvOption = "--password-env"
+
+// passwordArg removes the --password-env option from tokens and, if it was
+// given, inserts the value of the variable it names at position pos, where
+// the password argument would otherwise be. If the variable is unset or
+// empty, an error is written and ok is false.
+func (mpcli *MrPlotterCLIModule) passwordArg(output io.Writer, tokens []string, pos int) (remaining []string, argsOK bool, ok bool) {
+	remaining, name, argsOK := extractOption(tokens, passwordEnvOption)
+	if !argsOK || name == "" {
+		return remaining, argsOK, argsOK
+	}
+	password, set := os.LookupEnv(name)
+	if !set {
+		writeStringf(mpcli.errWriter(output), "Environment variable %s is not set\n", name)
+		return nil, true, false
+	}
+	if password == "" {
+		writeStringf(mpcli.errWriter(output), "Environment variable %s is empty\n", name)
+		return nil, true, false
+	}
+	if pos > len(remaining) {
+		return nil, false, false
+	}
+	remaining = append(remaining[:pos], append([]string{password}, remaining[pos:]...)...)
+	return remaining, true, true
+}
+
+// verifyCacheKey identifies a password that was checked for a user. Only a
+// hash of the password is kept.
+type verifyCacheKey struct {
+	username string
+	password [sha256.Size]byte
+}
+
+// verifyCacheEntry records that a password matched the stored hash, until
+// the expiry time.
+type verifyCacheEntry struct {
+	passwordHash []byte
+	expiry       time.Time
+}
+
+// verifyCache remembers successful password checks for a short time, so that
+// repeated checks of the same credentials do not each run bcrypt.
+type verifyCache struct {
+	ttl     time.Duration
+	lock    sync.Mutex
+	entries map[verifyCacheKey]verifyCacheEntry
+}
+
+// SetVerifyCacheTTL sets how long checkpassword remembers that a password was
+// correct. Zero, the default, disables the cache, so every check runs bcrypt.
+// A remembered result is used only if the account's password hash has not
+// changed since.
+func (mpcli *MrPlotterCLIModule) SetVerifyCacheTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		mpcli.verified = nil
+		return
+	}
+	mpcli.verified = &verifyCache{ttl: ttl, entries: make(map[verifyCacheKey]verifyCacheEntry)}
+}
+
+// lookup returns true if the password was recently found to match the given
+// password hash.
+func (vc *verifyCache) lookup(username string, password string, passwordHash []byte) bool {
+	key := verifyCacheKey{username, sha256.Sum256([]byte(password))}
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+	entry, ok := vc.entries[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(entry.expiry) || !bytes.Equal(entry.passwordHash, passwordHash) {
+		delete(vc.entries, key)
+		return false
+	}
+	return true
+}
+
+// remember records that the password matched the given password hash.
+func (vc *verifyCache) remember(username string, password string, passwordHash []byte) {
+	key := verifyCacheKey{username, sha256.Sum256([]byte(password))}
+	vc.lock.Lock()
+	defer vc.lock.Unlock()
+	vc.entries[key] = verifyCacheEntry{passwordHash: passwordHash, expiry: time.Now().Add(vc.ttl)}
+}
+
+func (mpcli *MrPlotterCLIModule) checkPasswordCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:       "checkpassword",
+		usageargs:  "username password",
+		hint:       "checks whether a password is correct for a user",
+		secretargs: []int{1},
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 2; !argsOK {
+				return
+			}
+			acc, err := mpcli.store.RetrieveAccount(ctx, tokens[0])
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if acc == nil {
+				writeStringln(mpcli.errWriter(output), accountNotExists)
+				return
+			}
+			if manage.IsLocked(acc) {
+				writeStringln(mpcli.errWriter(output), "Account is locked")
+				return
+			}
+			vc := mpcli.verified
+			correct := vc != nil && vc.lookup(acc.Username, tokens[1], acc.PasswordHash)
+			if !correct {
+				correct = acc.CheckPassword([]byte(tokens[1]))
+				if correct && vc != nil {
+					vc.remember(acc.Username, tokens[1], acc.PasswordHash)
+				}
+			}
+			if correct {
+				writeStringln(output, "Password is correct")
+			} else {
+				writeStringln(mpcli.errWriter(output), "Password is incorrect")
+			}
+			return
+		},
+	}
+}
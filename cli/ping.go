@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/immesys/smartgridstore/admincli"
+)
+
+// defaultPingTimeout bounds ping when the caller's context has no deadline.
+const defaultPingTimeout = 5 * time.Second
+
+// pingTagPrefix is a tag prefix that no real tag begins with, so that the
+// ping read returns nothing.
+const pingTagPrefix = "\x00ping"
+
+func (mpcli *MrPlotterCLIModule) pingCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "ping",
+		usageargs: "",
+		hint:      "checks that etcd is reachable and reports the round-trip latency",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 0; !argsOK {
+				return
+			}
+			if _, ok := ctx.Deadline(); !ok {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, defaultPingTimeout)
+				defer cancel()
+			}
+			start := time.Now()
+			_, err := mpcli.store.RetrieveMultipleTagDefs(ctx, pingTagPrefix)
+			latency := time.Since(start)
+			if err != nil {
+				writeStringf(mpcli.errWriter(output), "FAIL: etcd did not respond after %v: %v\n", latency, err)
+				return
+			}
+			writeStringf(output, "PASS: etcd responded in %v\n", latency)
+			return
+		},
+	}
+}
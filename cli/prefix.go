@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"io"
+	"strings"
+)
+
+// DefaultPrefixSeparator is the separator between levels of a BTrDB
+// collection path.
+const DefaultPrefixSeparator = "/"
+
+// SetPrefixSeparator sets the separator that path prefixes are expected to
+// end with, so that they match whole collection boundaries. If appendSep is
+// true, a missing separator is appended to new prefixes instead of only
+// producing a warning.
+func (mpcli *MrPlotterCLIModule) SetPrefixSeparator(sep string, appendSep bool) {
+	mpcli.prefixSep = sep
+	mpcli.appendSep = appendSep
+}
+
+// checkPrefixes warns about each non-empty prefix that does not end with the
+// separator, since such a prefix also matches sibling collections whose names
+// begin with it. It returns the prefixes, with the separator appended if that
+// is enabled.
+func (mpcli *MrPlotterCLIModule) checkPrefixes(output io.Writer, prefixes []string) []string {
+	if len(mpcli.prefixSep) == 0 {
+		return prefixes
+	}
+	checked := make([]string, len(prefixes))
+	for i, pfx := range prefixes {
+		checked[i] = pfx
+		if len(pfx) == 0 || strings.HasSuffix(pfx, mpcli.prefixSep) {
+			continue
+		}
+		if mpcli.appendSep {
+			checked[i] = pfx + mpcli.prefixSep
+			writeStringf(mpcli.warnWriter(output), "Warning: changed prefix %q to %q so that it matches whole collections\n", pfx, checked[i])
+		} else {
+			writeStringf(mpcli.warnWriter(output), "Warning: prefix %q does not end with %q, so it also matches collections such as %q\n", pfx, mpcli.prefixSep, pfx+"X"+mpcli.prefixSep)
+		}
+	}
+	return checked
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// previewTags shows how the access of an account would change if its tags
+// were replaced by those that change returns.
+func (mpcli *MrPlotterCLIModule) previewTags(ctx context.Context, output io.Writer, username string, change func(tags map[string]struct{}) map[string]struct{}) {
+	acc, err := mpcli.store.RetrieveAccount(ctx, username)
+	if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+		return
+	}
+	if acc == nil {
+		writeStringln(mpcli.errWriter(output), accountNotExists)
+		return
+	}
+	r := mpcli.newResolver(ctx)
+	before, err := r.prefixes(acc.Tags)
+	if err != nil {
+		writeStringf(mpcli.errWriter(output), "Could not retrieve tag information: %v\n", err)
+		return
+	}
+	after, err := r.prefixes(change(acc.Tags))
+	if err != nil {
+		writeStringf(mpcli.errWriter(output), "Could not retrieve tag information: %v\n", err)
+		return
+	}
+	gained, lost := setDifference(after, before), setDifference(before, after)
+	if len(gained) == 0 && len(lost) == 0 {
+		writeStringf(output, "%s: no change\n", username)
+		return
+	}
+	if len(gained) != 0 {
+		writeStringf(output, "%s would gain: %s\n", username, strings.Join(quotedSlice(gained), " "))
+	}
+	if len(lost) != 0 {
+		writeStringf(output, "%s would lose: %s\n", username, strings.Join(quotedSlice(lost), " "))
+	}
+}
+
+// quotedSlice returns the sorted elements of a set of prefixes, each quoted
+// as lsconf shows it.
+func quotedSlice(set map[string]struct{}) []string {
+	quoted := sortedSlice(set)
+	for i := range quoted {
+		quoted[i] = fmt.Sprintf("%q", quoted[i])
+	}
+	return quoted
+}
+
+// setDifference returns the elements of a that are not in b.
+func setDifference(a map[string]struct{}, b map[string]struct{}) map[string]struct{} {
+	diff := make(map[string]struct{})
+	for elem := range a {
+		if _, ok := b[elem]; !ok {
+			diff[elem] = struct{}{}
+		}
+	}
+	return diff
+}
+
+func (mpcli *MrPlotterCLIModule) previewGrantCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "previewgrant",
+		usageargs: "username tag1 [tag2] [tag3] ...",
+		hint:      "shows the prefixes that granting tags would give a user, without granting them",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) >= 2; !argsOK {
+				return
+			}
+			mpcli.previewTags(ctx, output, tokens[0], func(tags map[string]struct{}) map[string]struct{} {
+				granted := make(map[string]struct{}, len(tags)+len(tokens)-1)
+				for tag := range tags {
+					granted[tag] = struct{}{}
+				}
+				for _, tag := range tokens[1:] {
+					granted[tag] = struct{}{}
+				}
+				return granted
+			})
+			return
+		},
+	}
+}
+
+func (mpcli *MrPlotterCLIModule) previewRevokeCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "previewrevoke",
+		usageargs: "username tag1 [tag2] [tag3] ...",
+		hint:      "shows the prefixes that revoking tags would take from a user, without revoking them",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) >= 2; !argsOK {
+				return
+			}
+			revoked := sliceToSet(tokens[1:])
+			if _, ok := revoked[accounts.PublicTag]; ok {
+				writeManageError(mpcli.errWriter(output), manage.ErrRevokePublic)
+				return
+			}
+			mpcli.previewTags(ctx, output, tokens[0], func(tags map[string]struct{}) map[string]struct{} {
+				remaining := make(map[string]struct{}, len(tags))
+				for tag := range tags {
+					if _, ok := revoked[tag]; !ok {
+						remaining[tag] = struct{}{}
+					}
+				}
+				return remaining
+			})
+			return
+		},
+	}
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+func (mpcli *MrPlotterCLIModule) pruneTagsCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "prunetags",
+		usageargs:   "",
+		hint:        "revokes every tag that has no definition from every account (use --dry-run to see what would be revoked)",
+		mutates:     true,
+		destructive: true,
+		previewable: true,
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 0; !argsOK {
+				return
+			}
+			tagdefs, err := mpcli.store.RetrieveMultipleTagDefs(ctx, "")
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			defined := map[string]struct{}{accounts.AllTag: {}, accounts.PublicTag: {}}
+			for _, tagdef := range tagdefs {
+				defined[tagdef.Tag] = struct{}{}
+			}
+
+			undefined := make(map[string][]string)
+			var usernames []string
+			err = mpcli.store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+				for tag := range acc.Tags {
+					if _, ok := defined[tag]; !ok {
+						undefined[acc.Username] = append(undefined[acc.Username], tag)
+					}
+				}
+				if tags, ok := undefined[acc.Username]; ok {
+					sort.Strings(tags)
+					usernames = append(usernames, acc.Username)
+				}
+				return nil
+			})
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+
+			pruned, users := 0, 0
+			for i, username := range usernames {
+				if !mpcli.pause(ctx, output, i, len(usernames)) {
+					break
+				}
+				revoked, err := manage.RevokeTags(ctx, mpcli.store, username, undefined[username])
+				if errors.Is(err, manage.ErrAccountNotExists) {
+					continue
+				}
+				if writeManageError(mpcli.errWriter(output), err) {
+					break
+				}
+				if len(revoked) != 0 {
+					pruned += len(revoked)
+					users++
+				}
+			}
+			writeStringf(mpcli.infoWriter(output), "Pruned %d undefined tags from %d users\n", pruned, users)
+			return
+		},
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// SetRecorder sets a writer to which each mutating command that succeeds is
+// written, as a line that can be run again to repeat it. Commands in
+// submodules, such as those under "keys", are not recorded. Nil, the
+// default, disables recording.
+func (mpcli *MrPlotterCLIModule) SetRecorder(recorder io.Writer) {
+	mpcli.recorder = recorder
+}
+
+// quoteToken quotes a token, if necessary, so that it is read back as one
+// token with the same text.
+func quoteToken(token string) string {
+	if len(token) != 0 && !strings.ContainsAny(token, " \t\r\n\"'\\>") {
+		return token
+	}
+	token = strings.Replace(token, "\\", "\\\\", -1)
+	token = strings.Replace(token, "\"", "\\\"", -1)
+	return "\"" + token + "\""
+}
+
+func (mpcli *MrPlotterCLIModule) record(mpc *MrPlotterCommand) {
+	exec := mpc.exec
+	mpc.exec = func(ctx context.Context, output io.Writer, tokens ...string) bool {
+		failedBefore := mpcli.failed
+		mpcli.failed = false
+		argsOK := exec(ctx, output, tokens...)
+		if argsOK && !mpcli.failed && mpcli.recorder != nil {
+			line := make([]string, 0, len(tokens)+1)
+			line = append(line, mpc.name)
+			for _, token := range tokens {
+				line = append(line, quoteToken(token))
+			}
+			if _, err := io.WriteString(mpcli.recorder, strings.Join(line, " ")+"\n"); err != nil {
+				writeStringf(mpcli.warnWriter(output), "Warning: could not record command: %v\n", err)
+			}
+		}
+		mpcli.failed = mpcli.failed || failedBefore
+		return argsOK
+	}
+}
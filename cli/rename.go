@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// rename is a username and what renameusers would rename it to.
+type rename struct {
+	from string
+	to   string
+}
+
+// planRenames applies the substitution to each username that the expression
+// matches, returning the renames along with a description of each that would
+// collide with an existing username or another rename, or that would leave
+// an unusable username. Usernames are compared without regard to case if
+// foldCase is set.
+func planRenames(usernames []string, re *regexp.Regexp, replacement string, foldCase bool) ([]rename, []string) {
+	key := func(username string) string {
+		if foldCase {
+			return strings.ToLower(username)
+		}
+		return username
+	}
+	existing := make(map[string]string, len(usernames))
+	for _, username := range usernames {
+		existing[key(username)] = username
+	}
+	var renames []rename
+	var collisions []string
+	planned := make(map[string]string)
+	for _, username := range usernames {
+		if !re.MatchString(username) {
+			continue
+		}
+		to := re.ReplaceAllString(username, replacement)
+		if to == username {
+			continue
+		}
+		if err := checkName("username", to); err != nil {
+			collisions = append(collisions, username+": "+err.Error())
+			continue
+		}
+		if other, ok := existing[key(to)]; ok && other != username {
+			collisions = append(collisions, username+" -> "+to+": account "+other+" already exists")
+			continue
+		}
+		if other, ok := planned[key(to)]; ok {
+			collisions = append(collisions, username+" -> "+to+": "+other+" would also be renamed to it")
+			continue
+		}
+		planned[key(to)] = username
+		renames = append(renames, rename{from: username, to: to})
+	}
+	return renames, collisions
+}
+
+func (mpcli *MrPlotterCLIModule) renameUsersCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "renameusers",
+		usageargs:   "regex replacement",
+		hint:        "renames every account whose username the regular expression matches, substituting the replacement ($1 refers to a group), keeping tags and passwords",
+		mutates:     true,
+		destructive: true,
+		previewable: true,
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 2; !argsOK {
+				return
+			}
+			re, err := regexp.Compile(tokens[0])
+			if err != nil {
+				writeStringf(mpcli.errWriter(output), "Invalid regular expression: %v\n", err)
+				return
+			}
+
+			var usernames []string
+			err = mpcli.store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+				usernames = append(usernames, acc.Username)
+				return nil
+			})
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			renames, collisions := planRenames(usernames, re, tokens[1], mpcli.foldCase)
+			if len(collisions) != 0 {
+				for _, collision := range collisions {
+					writeStringln(mpcli.errWriter(output), collision)
+				}
+				writeStringf(mpcli.errWriter(output), "Refusing to rename: %d renames would collide\n", len(collisions))
+				return
+			}
+
+			renamed := 0
+			for i, rn := range renames {
+				if !mpcli.pause(ctx, output, i, len(renames)) {
+					break
+				}
+				for attempt := 0; attempt < txAttempts; attempt++ {
+					err = manage.RenameUser(ctx, mpcli.store, rn.from, rn.to)
+					if !errors.Is(err, manage.ErrTxFail) {
+						break
+					}
+				}
+				if writeManageError(mpcli.errWriter(output), err) {
+					break
+				}
+				renamed++
+			}
+			if renamed == 1 {
+				writeStringln(mpcli.infoWriter(output), "Renamed 1 account")
+			} else {
+				writeStringf(mpcli.infoWriter(output), "Renamed %d accounts\n", renamed)
+			}
+			return
+		},
+	}
+}
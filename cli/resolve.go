@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// resolver determines which collections a set of tags grants access to. It
+// caches the tag definitions it fetches, so one resolver should be used for
+// all of the accounts in a command. Commands that resolve the tags of more
+// than one account should call preload first.
+type resolver struct {
+	ctx       context.Context
+	preloaded bool
+	store     manage.Store
+	tagdefs   map[string]*accounts.MrPlotterTagDef
+}
+
+func (mpcli *MrPlotterCLIModule) newResolver(ctx context.Context) *resolver {
+	return &resolver{
+		ctx:     ctx,
+		store:   mpcli.store,
+		tagdefs: make(map[string]*accounts.MrPlotterTagDef),
+	}
+}
+
+// preload fetches every tag definition in one range query, so that resolving
+// tags never needs further reads.
+func (r *resolver) preload() error {
+	tagdefs, err := manage.RetrieveAllTagDefs(r.ctx, r.store)
+	if err != nil {
+		return err
+	}
+	r.tagdefs = tagdefs
+	r.preloaded = true
+	return nil
+}
+
+// tagDef returns the definition of a tag, or nil if it is not defined.
+func (r *resolver) tagDef(tag string) (*accounts.MrPlotterTagDef, error) {
+	if tagdef, ok := r.tagdefs[tag]; ok || r.preloaded {
+		return tagdef, nil
+	}
+	tagdef, err := r.store.RetrieveTagDef(r.ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	r.tagdefs[tag] = tagdef
+	return tagdef, nil
+}
+
+// undefinedNotes returns a note for each of the given tags that is not
+// defined, such as "[tag X undefined]".
+func (r *resolver) undefinedNotes(tags map[string]struct{}) ([]string, error) {
+	var notes []string
+	for _, tag := range sortedSlice(tags) {
+		if tag == accounts.AllTag || tag == accounts.PublicTag {
+			continue
+		}
+		tagdef, err := r.tagDef(tag)
+		if err != nil {
+			return nil, err
+		}
+		if tagdef == nil {
+			notes = append(notes, fmt.Sprintf("[tag %s undefined]", tag))
+		}
+	}
+	return notes, nil
+}
+
+// prefixes returns the union of the path prefixes of the given tags.
+// Undefined tags contribute nothing. The "all" tag is represented by the
+// empty prefix, which matches every collection.
+func (r *resolver) prefixes(tags map[string]struct{}) (map[string]struct{}, error) {
+	prefixes := make(map[string]struct{})
+	for tag := range tags {
+		if tag == accounts.AllTag {
+			prefixes[""] = struct{}{}
+			continue
+		}
+		tagdef, err := r.tagDef(tag)
+		if err != nil {
+			return nil, err
+		}
+		if tagdef == nil {
+			continue
+		}
+		for pfx := range tagdef.PathPrefix {
+			prefixes[pfx] = struct{}{}
+		}
+	}
+	return prefixes, nil
+}
+
+// matchTag returns the prefix of the tag's definition that the collection
+// begins with, as Mr. Plotter compares them, and whether there is one.
+func (r *resolver) matchTag(tag string, collection string) (string, bool, error) {
+	if tag == accounts.AllTag {
+		return "", true, nil
+	}
+	tagdef, err := r.tagDef(tag)
+	if err != nil || tagdef == nil {
+		return "", false, err
+	}
+	for _, pfx := range sortedSlice(tagdef.PathPrefix) {
+		if strings.HasPrefix(collection, pfx) {
+			return pfx, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// matchTags returns a tag among the given tags that grants access to the
+// collection, and whether there is one.
+func (r *resolver) matchTags(tags map[string]struct{}, collection string) (string, bool, error) {
+	for _, tag := range sortedSlice(tags) {
+		_, ok, err := r.matchTag(tag, collection)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			return tag, true, nil
+		}
+	}
+	return "", false, nil
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// txAttempts is how many times revokeall tries to update an account that
+// keeps changing between being read and written.
+const txAttempts = 3
+
+func (mpcli *MrPlotterCLIModule) revokeAllCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "revokeall",
+		usageargs:   "tag",
+		hint:        "revokes a tag from every account that holds it (use --dry-run to see which would change)",
+		mutates:     true,
+		destructive: true,
+		previewable: true,
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 1; !argsOK {
+				return
+			}
+			tag := tokens[0]
+			if tag == accounts.PublicTag {
+				writeManageError(mpcli.errWriter(output), manage.ErrRevokePublic)
+				return
+			}
+
+			var holders []string
+			err := mpcli.store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+				if _, ok := acc.Tags[tag]; ok {
+					holders = append(holders, acc.Username)
+				}
+				return nil
+			})
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+
+			revoked := 0
+			for i, username := range holders {
+				if !mpcli.pause(ctx, output, i, len(holders)) {
+					break
+				}
+				/* RevokeTags rereads the account, so a retry sees the other change. */
+				var changed []string
+				for attempt := 0; attempt < txAttempts; attempt++ {
+					changed, err = manage.RevokeTags(ctx, mpcli.store, username, []string{tag})
+					if !errors.Is(err, manage.ErrTxFail) {
+						break
+					}
+				}
+				if errors.Is(err, manage.ErrAccountNotExists) {
+					continue
+				}
+				if writeManageError(mpcli.errWriter(output), err) {
+					break
+				}
+				revoked += len(changed)
+			}
+			if revoked == 1 {
+				writeStringf(mpcli.infoWriter(output), "Revoked \"%s\" from 1 account\n", tag)
+			} else {
+				writeStringf(mpcli.infoWriter(output), "Revoked \"%s\" from %d accounts\n", tag, revoked)
+			}
+			return
+		},
+	}
+}
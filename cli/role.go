@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+	"github.com/samkumar/mr-plotter-conf/meta"
+)
+
+const roleNotExists = "Role is not defined"
+
+// roleDiff returns the tags of the role that the account lacks, and the tags
+// the account holds beyond the role. Every account is expected to hold the
+// public tag, so it never counts as extra.
+func roleDiff(acc *accounts.MrPlotterAccount, role *meta.Role) (missing []string, extra []string) {
+	roleTags := sliceToSet(role.Tags)
+	for tag := range roleTags {
+		if _, ok := acc.Tags[tag]; !ok {
+			missing = append(missing, tag)
+		}
+	}
+	for tag := range acc.Tags {
+		if _, ok := roleTags[tag]; !ok && tag != accounts.PublicTag {
+			extra = append(extra, tag)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return
+}
+
+// retrieveRole looks up a role, writing an error if it cannot be found.
+func (mpcli *MrPlotterCLIModule) retrieveRole(ctx context.Context, output io.Writer, name string) *meta.Role {
+	role, err := mpcli.store.RetrieveRole(ctx, name)
+	if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+		return nil
+	}
+	if role == nil {
+		writeStringln(mpcli.errWriter(output), roleNotExists)
+	}
+	return role
+}
+
+func (mpcli *MrPlotterCLIModule) defRoleCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "defrole",
+		usageargs: "role tag1 tag2 ...",
+		hint:      "defines a role as a set of tags, replacing any existing definition, for use with checkrole and applyrole",
+		mutates:   true,
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) >= 2; !argsOK {
+				return
+			}
+			tags := sortedSlice(sliceToSet(tokens[1:]))
+			for _, tag := range tags {
+				if tag == accounts.AllTag || tag == accounts.PublicTag {
+					continue
+				}
+				tagdef, err := mpcli.store.RetrieveTagDef(ctx, tag)
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				if tagdef == nil {
+					writeStringf(mpcli.warnWriter(output), "Warning: tag \"%s\" is not defined\n", tag)
+				}
+			}
+			err := mpcli.store.UpsertRole(ctx, &meta.Role{Name: tokens[0], Tags: tags})
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			writeStringf(mpcli.infoWriter(output), "Defined role %s with tags: %s\n", tokens[0], strings.Join(tags, " "))
+			return
+		},
+	}
+}
+
+func (mpcli *MrPlotterCLIModule) checkRoleCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "checkrole",
+		usageargs: "username role",
+		hint:      "lists the tags of a role that a user is missing, and the tags the user holds beyond it",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 2; !argsOK {
+				return
+			}
+			acc, err := mpcli.store.RetrieveAccount(ctx, tokens[0])
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if acc == nil {
+				writeStringln(mpcli.errWriter(output), accountNotExists)
+				return
+			}
+			role := mpcli.retrieveRole(ctx, output, tokens[1])
+			if role == nil {
+				return
+			}
+			missing, extra := roleDiff(acc, role)
+			if len(missing) == 0 && len(extra) == 0 {
+				writeStringf(output, "%s matches role %s\n", acc.Username, role.Name)
+				return
+			}
+			if len(missing) != 0 {
+				writeStringf(output, "Missing: %s\n", strings.Join(missing, " "))
+			}
+			if len(extra) != 0 {
+				writeStringf(output, "Extra: %s\n", strings.Join(extra, " "))
+			}
+			return
+		},
+	}
+}
+
+func (mpcli *MrPlotterCLIModule) applyRoleCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "applyrole",
+		usageargs:   "username role",
+		hint:        fmt.Sprintf("grants a user the tags of a role and revokes every other tag except \"%s\"", accounts.PublicTag),
+		mutates:     true,
+		previewable: true,
+		destructive: true,
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 2; !argsOK {
+				return
+			}
+			role := mpcli.retrieveRole(ctx, output, tokens[1])
+			if role == nil {
+				return
+			}
+			acc, err := mpcli.store.RetrieveAccount(ctx, tokens[0])
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if acc == nil {
+				writeStringln(mpcli.errWriter(output), accountNotExists)
+				return
+			}
+			missing, extra := roleDiff(acc, role)
+			if len(missing) == 0 && len(extra) == 0 {
+				writeStringf(mpcli.infoWriter(output), "%s already matches role %s\n", acc.Username, role.Name)
+				return
+			}
+			acc.Tags = sliceToSet(role.Tags)
+			acc.Tags[accounts.PublicTag] = struct{}{}
+			success, err := mpcli.store.UpsertAccountAtomically(ctx, acc)
+			if !success {
+				writeStringln(mpcli.errWriter(output), txFail)
+				return
+			}
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			/* The role now decides every tag the account holds. */
+			err = manage.ClearTemporaryGrant(ctx, mpcli.store, acc.Username, append(extra, role.Tags...))
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if len(missing) != 0 {
+				writeStringf(mpcli.infoWriter(output), "Granted: %s\n", strings.Join(missing, " "))
+			}
+			if len(extra) != 0 {
+				writeStringf(mpcli.infoWriter(output), "Revoked: %s\n", strings.Join(extra, " "))
+			}
+			return
+		},
+	}
+}
+
+// tagGroup is the set of accounts holding exactly the same tags.
+type tagGroup struct {
+	tags      []string
+	usernames []string
+}
+
+func (mpcli *MrPlotterCLIModule) groupUsersCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "groupusers",
+		usageargs: "[usernameprefix]",
+		hint:      "groups accounts by their exact set of tags, largest group first, showing candidates for roles",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 0 || len(tokens) == 1; !argsOK {
+				return
+			}
+			prefix := ""
+			if len(tokens) == 1 {
+				prefix = tokens[0]
+			}
+			groups := make(map[string]*tagGroup)
+			err := mpcli.store.ForEachAccount(ctx, prefix, func(acc *accounts.MrPlotterAccount) error {
+				if acc.Tags == nil {
+					writeStringf(mpcli.warnWriter(output), "Skipped %s [CORRUPT ENTRY]\n", acc.Username)
+					return nil
+				}
+				tags := sortedSlice(acc.Tags)
+				key := strings.Join(tags, "\x00")
+				group, ok := groups[key]
+				if !ok {
+					group = &tagGroup{tags: tags}
+					groups[key] = group
+				}
+				group.usernames = append(group.usernames, acc.Username)
+				return nil
+			})
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			sorted := make([]*tagGroup, 0, len(groups))
+			for _, group := range groups {
+				sorted = append(sorted, group)
+			}
+			sort.Slice(sorted, func(i, j int) bool {
+				if len(sorted[i].usernames) != len(sorted[j].usernames) {
+					return len(sorted[i].usernames) > len(sorted[j].usernames)
+				}
+				return strings.Join(sorted[i].tags, "\x00") < strings.Join(sorted[j].tags, "\x00")
+			})
+			for _, group := range sorted {
+				writeStringf(output, "%d accounts: %s\n", len(group.usernames), strings.Join(group.tags, " "))
+				for _, username := range group.usernames {
+					writeStringf(output, "    %s\n", username)
+				}
+			}
+			return
+		},
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+)
+
+// fuzzyMatch reports whether term occurs in s, either as a substring or as a
+// subsequence of its characters. Matching is case-insensitive.
+func fuzzyMatch(s string, term string) bool {
+	s = strings.ToLower(s)
+	term = strings.ToLower(term)
+	if strings.Contains(s, term) {
+		return true
+	}
+	i := 0
+	for _, c := range s {
+		if i == len(term) {
+			break
+		}
+		if strings.HasPrefix(term[i:], string(c)) {
+			i += len(string(c))
+		}
+	}
+	return i == len(term)
+}
+
+func (mpcli *MrPlotterCLIModule) searchCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "search",
+		usageargs: "term",
+		hint:      "finds usernames, granted tags, tag definitions, and path prefixes matching a term",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 1; !argsOK {
+				return
+			}
+			term := tokens[0]
+
+			tagdefs, err := mpcli.store.RetrieveMultipleTagDefs(ctx, "")
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+
+			var users []string
+			var grants []string
+			err = mpcli.store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+				if fuzzyMatch(acc.Username, term) {
+					users = append(users, acc.Username)
+				}
+				for tag := range acc.Tags {
+					if fuzzyMatch(tag, term) {
+						grants = append(grants, fmt.Sprintf("%s: %s", acc.Username, tag))
+					}
+				}
+				return nil
+			})
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+
+			var tags []string
+			var prefixes []string
+			for _, tagdef := range tagdefs {
+				if fuzzyMatch(tagdef.Tag, term) {
+					tags = append(tags, tagdef.Tag)
+				}
+				for pfx := range tagdef.PathPrefix {
+					if fuzzyMatch(pfx, term) {
+						prefixes = append(prefixes, fmt.Sprintf("%s: %q", tagdef.Tag, pfx))
+					}
+				}
+			}
+
+			groups := []struct {
+				kind string
+				hits []string
+			}{
+				{"Usernames", users},
+				{"Granted tags", grants},
+				{"Tag definitions", tags},
+				{"Path prefixes", prefixes},
+			}
+			found := false
+			for _, group := range groups {
+				if len(group.hits) == 0 {
+					continue
+				}
+				found = true
+				sort.Strings(group.hits)
+				writeStringf(output, "%s:\n", group.kind)
+				for _, hit := range group.hits {
+					writeStringf(output, "    %s\n", hit)
+				}
+			}
+			if !found {
+				writeStringf(output, "No matches for '%s'\n", term)
+			}
+			return
+		},
+	}
+}
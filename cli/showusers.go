@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/immesys/smartgridstore/admincli"
+)
+
+// readNames reads one name per line from a file, skipping blank lines.
+func readNames(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var names []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) != 0 {
+			names = append(names, line)
+		}
+	}
+	return names, scanner.Err()
+}
+
+func (mpcli *MrPlotterCLIModule) showUsersCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "showusers",
+		usageargs: "[--format template] --file file",
+		hint:      "shows the tags granted to each user named in a file, one per line; users that do not exist are reported as errors",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			tokens, path, argsOK := extractOption(tokens, "--file")
+			if !argsOK {
+				return
+			}
+			tokens, tmpl, argsOK, ok := mpcli.parseFormat(output, tokens)
+			if argsOK = argsOK && len(tokens) == 0 && len(path) != 0; !argsOK || !ok {
+				return
+			}
+			usernames, err := readNames(path)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			missing := 0
+			for _, username := range usernames {
+				acc, err := mpcli.store.RetrieveAccount(ctx, username)
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				if acc == nil {
+					writeStringf(mpcli.errWriter(output), "no such user: %s\n", username)
+					missing++
+					continue
+				}
+				if tmpl != nil {
+					if mpcli.writeTemplate(output, tmpl, newAccountRecord(acc)) != nil {
+						return
+					}
+					continue
+				}
+				writeStringf(output, "%s: %s\n", acc.Username, strings.Join(sortedSlice(acc.Tags), " "))
+			}
+			writeStringf(mpcli.infoWriter(output), "Showed %d users, %d not found\n", len(usernames)-missing, missing)
+			return
+		},
+	}
+}
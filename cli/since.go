@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// timeLayouts are the formats accepted for times given on the command line.
+// Those without a time zone are interpreted in local time.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTime parses a time given as RFC 3339 or as a plain date, optionally
+// followed by a time of day.
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s' (expected a date like 2006-01-02 or an RFC 3339 time)", value)
+}
+
+// timeWindow is the span of modification times selected by --since, --after,
+// and --before. A zero bound is open.
+type timeWindow struct {
+	after  time.Time
+	before time.Time
+}
+
+// parseTimeWindow parses the bounds given to --since or --after, which mean
+// the same, and --before. It returns nil if none was given.
+func parseTimeWindow(since string, after string, before string) (*timeWindow, error) {
+	if since != "" && after != "" {
+		return nil, errors.New("--since and --after cannot both be given")
+	}
+	if since != "" {
+		after = since
+	}
+	if after == "" && before == "" {
+		return nil, nil
+	}
+	window := &timeWindow{}
+	var err error
+	if after != "" {
+		if window.after, err = parseTime(after); err != nil {
+			return nil, err
+		}
+	}
+	if before != "" {
+		if window.before, err = parseTime(before); err != nil {
+			return nil, err
+		}
+	}
+	if !window.after.IsZero() && !window.before.IsZero() && !window.after.Before(window.before) {
+		return nil, errors.New("the --after time must be earlier than the --before time")
+	}
+	return window, nil
+}
+
+// contains returns true if t is strictly within the window.
+func (w *timeWindow) contains(t time.Time) bool {
+	return (w.after.IsZero() || t.After(w.after)) && (w.before.IsZero() || t.Before(w.before))
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"context"
+	"io"
+
+	"github.com/samkumar/mr-plotter-conf/logging"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// SetSnapshotReads controls whether each command that only reads the
+// configuration reads all of it at a single etcd revision, so that changes
+// made while it runs cannot give it a torn view.
+func (mpcli *MrPlotterCLIModule) SetSnapshotReads(snapshot bool) {
+	mpcli.snapshot = snapshot
+}
+
+// readSnapshot makes mpc run against a store that reads the configuration
+// as it was when mpc started, if snapshot reads are enabled.
+func (mpcli *MrPlotterCLIModule) readSnapshot(mpc *MrPlotterCommand) {
+	exec := mpc.exec
+	mpc.exec = func(ctx context.Context, output io.Writer, tokens ...string) bool {
+		if !mpcli.snapshot {
+			return exec(ctx, output, tokens...)
+		}
+		snapshot, rev, err := manage.NewSnapshotStore(ctx, mpcli.ecl)
+		if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+			return true
+		}
+		logging.Debugf("%s: reading at revision %d", mpc.name, rev)
+		store := mpcli.store
+		mpcli.store = snapshot
+		defer func() {
+			mpcli.store = store
+		}()
+		return exec(ctx, output, tokens...)
+	}
+}
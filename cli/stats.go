@@ -0,0 +1,275 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+)
+
+// tagCount is a count for a tag.
+type tagCount struct {
+	tag   string
+	count int
+}
+
+// sortTagCounts sorts by descending count, breaking ties by tag name.
+func sortTagCounts(counts []tagCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count > counts[j].count
+		}
+		return counts[i].tag < counts[j].tag
+	})
+}
+
+// userCount is a count for a user account.
+type userCount struct {
+	username string
+	count    int
+}
+
+// sortUserCounts sorts by descending count, breaking ties by username.
+func sortUserCounts(counts []userCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count > counts[j].count
+		}
+		return counts[i].username < counts[j].username
+	})
+}
+
+func (mpcli *MrPlotterCLIModule) statsCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "stats",
+		usageargs: "",
+		hint:      "summarizes how tags are distributed across user accounts",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 0; !argsOK {
+				return
+			}
+
+			tagdefs, err := mpcli.store.RetrieveMultipleTagDefs(ctx, "")
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			usage := make(map[string]int)
+			for _, tagdef := range tagdefs {
+				usage[tagdef.Tag] = 0
+			}
+			// The "all" tag has no definition in etcd, but it is as real a
+			// grant as any other tag, so count it too.
+			usage[accounts.AllTag] = 0
+
+			var totalTags int
+			var valid int
+			var corrupt int
+			var publicOnly int
+			err = mpcli.store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+				if acc.Tags == nil {
+					corrupt++
+					return nil
+				}
+				valid++
+				totalTags += len(acc.Tags)
+				for tag := range acc.Tags {
+					if count, ok := usage[tag]; ok {
+						usage[tag] = count + 1
+					}
+				}
+				if _, ok := acc.Tags[accounts.PublicTag]; ok && len(acc.Tags) == 1 {
+					publicOnly++
+				}
+				return nil
+			})
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+
+			counts := make([]tagCount, 0, len(usage))
+			for tag, count := range usage {
+				counts = append(counts, tagCount{tag, count})
+			}
+			sortTagCounts(counts)
+
+			var average float64
+			if valid != 0 {
+				average = float64(totalTags) / float64(valid)
+			}
+
+			writeStringf(output, "Accounts: %d\n", valid+corrupt)
+			if corrupt != 0 {
+				writeStringf(output, "Corrupt accounts: %d\n", corrupt)
+			}
+			writeStringf(output, "Tag definitions: %d\n", len(tagdefs))
+			writeStringf(output, "Average tags per account: %.2f\n", average)
+			writeStringf(output, "Accounts with only the \"%s\" tag: %d\n", accounts.PublicTag, publicOnly)
+			writeStringln(output, "Accounts holding each tag:")
+			for _, tc := range counts {
+				writeStringf(output, "    %s: %d\n", tc.tag, tc.count)
+			}
+			return
+		},
+	}
+}
+
+const defaultTopTags = 10
+
+func (mpcli *MrPlotterCLIModule) topTagsCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "toptags",
+		usageargs: "[--by prefixes|users] [n]",
+		hint:      "shows the n tags (10 by default) with the most path prefixes, or held by the most users",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			tokens, by, argsOK := extractOption(tokens, "--by")
+			if argsOK = argsOK && len(tokens) <= 1; !argsOK {
+				return
+			}
+			n := defaultTopTags
+			if len(tokens) == 1 {
+				var err error
+				n, err = strconv.Atoi(tokens[0])
+				if argsOK = err == nil && n > 0; !argsOK {
+					return
+				}
+			}
+
+			var counts []tagCount
+			switch by {
+			case "", "prefixes":
+				tagdefs, err := mpcli.store.RetrieveMultipleTagDefs(ctx, "")
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				for _, tagdef := range tagdefs {
+					counts = append(counts, tagCount{tagdef.Tag, len(tagdef.PathPrefix)})
+				}
+			case "users":
+				usage := make(map[string]int)
+				err := mpcli.store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+					for tag := range acc.Tags {
+						usage[tag]++
+					}
+					return nil
+				})
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				for tag, count := range usage {
+					counts = append(counts, tagCount{tag, count})
+				}
+			default:
+				argsOK = false
+				return
+			}
+			sortTagCounts(counts)
+			if len(counts) > n {
+				counts = counts[:n]
+			}
+			for _, tc := range counts {
+				writeStringf(output, "%s: %d\n", tc.tag, tc.count)
+			}
+			return
+		},
+	}
+}
+
+const defaultFatUsers = 10
+
+func (mpcli *MrPlotterCLIModule) fatUsersCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "fatusers",
+		usageargs: "[--by-prefixes] [n]",
+		hint:      "shows the n accounts (10 by default) with the most tags, or with the most prefixes once their tags are resolved",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			tokens, byPrefixes := extractFlag(tokens, "--by-prefixes")
+			if argsOK = len(tokens) <= 1; !argsOK {
+				return
+			}
+			n := defaultFatUsers
+			if len(tokens) == 1 {
+				var err error
+				n, err = strconv.Atoi(tokens[0])
+				if argsOK = err == nil && n > 0; !argsOK {
+					return
+				}
+			}
+
+			var r *resolver
+			if byPrefixes {
+				r = mpcli.newResolver(ctx)
+				if err := r.preload(); err != nil {
+					writeStringf(mpcli.errWriter(output), "Could not retrieve tag information: %v\n", err)
+					return
+				}
+			}
+			/* Holders of the "all" tag rank above everyone when counting prefixes. */
+			everything := make(map[string]struct{})
+			var counts []userCount
+			err := mpcli.store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+				if !byPrefixes {
+					counts = append(counts, userCount{acc.Username, len(acc.Tags)})
+					return nil
+				}
+				prefixes, err := r.prefixes(acc.Tags)
+				if err != nil {
+					return err
+				}
+				if _, ok := prefixes[""]; ok {
+					everything[acc.Username] = struct{}{}
+					counts = append(counts, userCount{acc.Username, math.MaxInt32})
+					return nil
+				}
+				counts = append(counts, userCount{acc.Username, len(prefixes)})
+				return nil
+			})
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			sortUserCounts(counts)
+			if len(counts) > n {
+				counts = counts[:n]
+			}
+			for _, uc := range counts {
+				if _, ok := everything[uc.username]; ok {
+					writeStringf(output, "%s: [ALL STREAMS]\n", uc.username)
+				} else {
+					writeStringf(output, "%s: %d\n", uc.username, uc.count)
+				}
+			}
+			return
+		},
+	}
+}
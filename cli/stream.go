@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// exportStreamFile writes a streamed export to a file readable only by its
+// owner.
+func exportStreamFile(ctx context.Context, store manage.Store, path string) (int, int, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	accs, tagdefs, err := manage.ExportStream(ctx, store, writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	return accs, tagdefs, err
+}
+
+// isStreamFile returns true if a file to be imported was written by export
+// --stream, which is told apart from an ordinary JSON export by the type
+// field of its first record.
+func isStreamFile(path string, format string) (bool, error) {
+	format, err := fileFormat(path, format)
+	if err != nil || format != "json" {
+		return false, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	var first struct {
+		Type string `json:"type"`
+	}
+	if err = json.NewDecoder(file).Decode(&first); err != nil {
+		/* Leave it to the ordinary import to report. */
+		return false, nil
+	}
+	return len(first.Type) != 0, nil
+}
+
+// countRecords returns the number of non-blank lines in a file.
+func countRecords(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	n := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) != 0 {
+			n++
+		}
+	}
+	return n, scanner.Err()
+}
+
+// importStream imports a file written by export --stream one record at a
+// time, so that the whole file is never held in memory.
+func (mpcli *MrPlotterCLIModule) importStream(ctx context.Context, output io.Writer, path string) {
+	total, err := countRecords(path)
+	if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+		return
+	}
+	file, err := os.Open(path)
+	if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+		return
+	}
+	defer file.Close()
+
+	var tagdefs, accs int
+	defer func() {
+		writeStringf(mpcli.infoWriter(output), "Imported %d tag definitions and %d accounts\n", tagdefs, accs)
+	}()
+	decoder := json.NewDecoder(file)
+	for {
+		var record manage.StreamRecord
+		err = decoder.Decode(&record)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			writeStringf(mpcli.errWriter(output), "Could not decode record %d: %v\n", tagdefs+accs+1, err)
+			return
+		}
+		if !mpcli.pause(ctx, output, tagdefs+accs, total) {
+			return
+		}
+		switch {
+		case record.Type == manage.StreamAccount && record.DumpAccount != nil:
+			err = mpcli.store.UpsertAccount(ctx, record.DumpAccount.Account())
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			accs++
+		case record.Type == manage.StreamTagDef && record.DumpTagDef != nil:
+			err = checkDump(&manage.Dump{TagDefs: []manage.DumpTagDef{*record.DumpTagDef}})
+			if err == nil {
+				err = mpcli.store.UpsertTagDef(ctx, record.DumpTagDef.TagDef())
+			}
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			tagdefs++
+		default:
+			writeStringf(mpcli.errWriter(output), "Record %d has unknown type '%s'\n", tagdefs+accs+1, record.Type)
+			return
+		}
+	}
+}
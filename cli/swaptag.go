@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"context"
+	"io"
+
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+func (mpcli *MrPlotterCLIModule) swapTagCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "swaptag",
+		usageargs:   "[--force] [--i-understand] username oldtag newtag",
+		hint:        "replaces one of a user's tags with another in a single write, so that the user never holds both or neither",
+		mutates:     true,
+		destructive: true,
+		previewable: true,
+		flags:       []string{"--force", understandFlag},
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			tokens, force := extractFlag(tokens, "--force")
+			tokens, understood := extractFlag(tokens, understandFlag)
+			if argsOK = len(tokens) == 3; !argsOK {
+				return
+			}
+			username, oldTag, newTag := tokens[0], tokens[1], tokens[2]
+			if oldTag == newTag {
+				writeStringln(mpcli.errWriter(output), "The old and new tags are the same")
+				return
+			}
+			if mpcli.needsToken(TokenAllTag) {
+				if !mpcli.confirmAllTagToken(output, username, []string{newTag}, understood) {
+					return
+				}
+			} else if !force && !mpcli.confirmAllTag(output, username, []string{newTag}) {
+				return
+			}
+			held, err := manage.SwapTag(ctx, mpcli.store, username, oldTag, newTag, force)
+			if writeManageError(mpcli.errWriter(output), err) {
+				return
+			}
+			if held {
+				writeStringf(mpcli.infoWriter(output), "Replaced %s with %s for %s\n", oldTag, newTag, username)
+			} else {
+				writeStringf(mpcli.infoWriter(output), "%s did not hold %s; granted %s\n", username, oldTag, newTag)
+			}
+			return
+		},
+	}
+}
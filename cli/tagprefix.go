@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// tagsWithPrefix returns the tags defined now whose names begin with the
+// prefix, for grant --tag-prefix. It lists them and, when interactive, asks
+// the operator to confirm granting them to the user, unless forced or only
+// previewing. It returns false if there are none or the operator declines.
+func (mpcli *MrPlotterCLIModule) tagsWithPrefix(ctx context.Context, output io.Writer, username string, prefix string, force bool) ([]string, bool) {
+	tagdefs, err := mpcli.store.RetrieveMultipleTagDefs(ctx, prefix)
+	if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+		return nil, false
+	}
+	if len(tagdefs) == 0 {
+		writeStringf(mpcli.errWriter(output), "No defined tag begins with '%s'\n", prefix)
+		return nil, false
+	}
+	tags := make([]string, len(tagdefs))
+	for i, tagdef := range tagdefs {
+		tags[i] = tagdef.Tag
+	}
+	writeStringf(mpcli.infoWriter(output), "Tags beginning with '%s': %s\n", prefix, strings.Join(tags, " "))
+	if mpcli.interactive && !force && !mpcli.dryRun {
+		if !mpcli.confirm(output, fmt.Sprintf("Grant these %d tags to %s?", len(tags), username)) {
+			writeStringln(mpcli.errWriter(output), "Not granting")
+			return nil, false
+		}
+	}
+	return tags, true
+}
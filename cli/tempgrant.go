@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/meta"
+)
+
+func (mpcli *MrPlotterCLIModule) grantAllCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "grantall",
+		usageargs: "[--force] [--i-understand] username duration",
+		hint:      fmt.Sprintf("temporarily grants the \"%s\" tag to a user; once the duration (e.g. 30m or 4h) has elapsed, reapgrants revokes it", accounts.AllTag),
+		mutates:   true,
+		flags:     []string{"--force", understandFlag},
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			tokens, force := extractFlag(tokens, "--force")
+			tokens, understood := extractFlag(tokens, understandFlag)
+			if argsOK = len(tokens) == 2; !argsOK {
+				return
+			}
+			duration, err := time.ParseDuration(tokens[1])
+			if err != nil || duration <= 0 {
+				writeStringf(mpcli.errWriter(output), "Invalid duration '%s'\n", tokens[1])
+				return
+			}
+			acc, err := mpcli.store.RetrieveAccount(ctx, tokens[0])
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if acc == nil {
+				writeStringln(mpcli.errWriter(output), accountNotExists)
+				return
+			}
+			tg, err := mpcli.store.RetrieveTemporaryGrant(ctx, acc.Username)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if _, ok := acc.Tags[accounts.AllTag]; ok && tg == nil {
+				writeStringf(mpcli.errWriter(output), "%s already holds the \"%s\" tag permanently\n", acc.Username, accounts.AllTag)
+				return
+			}
+
+			if mpcli.needsToken(TokenAllTag) {
+				if !mpcli.confirmToken(output, fmt.Sprintf("grant the \"%s\" tag to %s for %v", accounts.AllTag, acc.Username, duration), understood) {
+					return
+				}
+			} else if !force && !mpcli.confirmAllTag(output, acc.Username, []string{accounts.AllTag}) {
+				return
+			}
+
+			acc.Tags[accounts.AllTag] = struct{}{}
+			success, err := mpcli.store.UpsertAccountAtomically(ctx, acc)
+			if !success {
+				writeStringln(mpcli.errWriter(output), txFail)
+				return
+			}
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			tg = &meta.TemporaryGrant{Username: acc.Username, Tag: accounts.AllTag, Expiry: time.Now().Add(duration)}
+			err = mpcli.store.UpsertTemporaryGrant(ctx, tg)
+			if err != nil {
+				writeStringf(mpcli.errWriter(output), "Granted \"%s\" to %s, but could not record when it expires, so reapgrants will not revoke it: %v\n", accounts.AllTag, acc.Username, err)
+				return
+			}
+			writeStringf(mpcli.infoWriter(output), "Granted \"%s\" to %s until %s\n", accounts.AllTag, acc.Username, tg.Expiry.Format(time.RFC3339))
+			return
+		},
+	}
+}
+
+func (mpcli *MrPlotterCLIModule) reapGrantsCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "reapgrants",
+		usageargs:   "",
+		hint:        "revokes temporary grants whose duration has elapsed",
+		mutates:     true,
+		destructive: true,
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 0; !argsOK {
+				return
+			}
+			tgs, err := mpcli.store.RetrieveAllTemporaryGrants(ctx)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			now := time.Now()
+			reaped := 0
+			for i, tg := range tgs {
+				if !tg.Expired(now) {
+					continue
+				}
+				if !mpcli.pause(ctx, output, i, len(tgs)) {
+					return
+				}
+				acc, err := mpcli.store.RetrieveAccount(ctx, tg.Username)
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				if acc != nil && acc.Tags != nil {
+					if _, ok := acc.Tags[tg.Tag]; ok {
+						delete(acc.Tags, tg.Tag)
+						success, err := mpcli.store.UpsertAccountAtomically(ctx, acc)
+						if !success {
+							writeStringf(mpcli.errWriter(output), "Could not revoke \"%s\" from %s: %s\n", tg.Tag, tg.Username, txFail)
+							continue
+						}
+						if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+							continue
+						}
+					}
+				}
+				err = mpcli.store.DeleteTemporaryGrant(ctx, tg.Username)
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					continue
+				}
+				writeStringf(mpcli.infoWriter(output), "Revoked \"%s\" from %s\n", tg.Tag, tg.Username)
+				reaped++
+			}
+			if reaped == 1 {
+				writeStringln(mpcli.infoWriter(output), "Reaped 1 temporary grant")
+			} else {
+				writeStringf(mpcli.infoWriter(output), "Reaped %v temporary grants\n", reaped)
+			}
+			return
+		},
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// progressInterval is how often bulk commands report their progress.
+const progressInterval = 2 * time.Second
+
+// SetWriteRate limits the commands that write many records to etcd to the
+// given number of writes per second, so that they do not overwhelm a cluster
+// shared with Mr. Plotter and BTrDB. A rate of zero removes the limit.
+func (mpcli *MrPlotterCLIModule) SetWriteRate(perSecond float64) {
+	if perSecond <= 0 {
+		mpcli.limiter = nil
+	} else {
+		mpcli.limiter = rate.NewLimiter(rate.Limit(perSecond), 1)
+	}
+}
+
+// throttle waits until the next write in a bulk command is allowed. It fails
+// if the command has been cancelled or has timed out.
+func (mpcli *MrPlotterCLIModule) throttle(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if mpcli.limiter == nil {
+		return nil
+	}
+	return mpcli.limiter.Wait(ctx)
+}
+
+// progress reports, to the error output, how far a bulk command has got,
+// unless it reported less than progressInterval ago or has only just begun.
+// This shows that a large command against a slow etcd is not stuck, without
+// mixing into its results.
+func (mpcli *MrPlotterCLIModule) progress(output io.Writer, done int, total int) {
+	now := time.Now()
+	if done == 0 {
+		mpcli.lastProgress = now
+		return
+	}
+	if mpcli.quiet || now.Sub(mpcli.lastProgress) < progressInterval {
+		return
+	}
+	mpcli.lastProgress = now
+	writeStringf(mpcli.warnWriter(output), "processed %d/%d...\n", done, total)
+}
+
+// pause is called by bulk commands before each item, of which done have been
+// processed out of total. It returns false if the command should stop, after
+// reporting how far it got.
+func (mpcli *MrPlotterCLIModule) pause(ctx context.Context, output io.Writer, done int, total int) bool {
+	mpcli.progress(output, done, total)
+	err := mpcli.throttle(ctx)
+	switch {
+	case err == nil:
+		return true
+	case err == context.Canceled:
+		writeStringf(mpcli.errWriter(output), "Interrupted after %d of %d items\n", done, total)
+	case err == context.DeadlineExceeded:
+		writeStringf(mpcli.errWriter(output), "Timed out after %d of %d items\n", done, total)
+	default:
+		writeError(mpcli.errWriter(output), err)
+	}
+	return false
+}
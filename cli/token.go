@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The riskiest operations, which can be made to require the operator to type
+// a random token rather than just "y".
+const (
+	// TokenAllTag is granting the "all" tag, with grant or grantall.
+	TokenAllTag = "all-tag"
+
+	// TokenRmUsersAll is rmusers with an empty prefix, which deletes every
+	// account.
+	TokenRmUsersAll = "rmusers-all"
+)
+
+// DefaultTokenOperations are the operations that require a token unless
+// configured otherwise.
+var DefaultTokenOperations = []string{TokenAllTag, TokenRmUsersAll}
+
+// understandFlag lets a script run an operation that requires a token,
+// since there is no one to type it.
+const understandFlag = "--i-understand"
+
+// SetTokenOperations sets which of the operations named by the Token
+// constants require the operator to type a confirmation token. In scripts,
+// where there is no one to type it, they must be given --i-understand.
+func (mpcli *MrPlotterCLIModule) SetTokenOperations(ops []string) error {
+	tokenOps := make(map[string]struct{}, len(ops))
+	for _, op := range ops {
+		if op != TokenAllTag && op != TokenRmUsersAll {
+			return fmt.Errorf("unknown operation '%s' (expected %s)", op, strings.Join(DefaultTokenOperations, " or "))
+		}
+		tokenOps[op] = struct{}{}
+	}
+	mpcli.tokenOps = tokenOps
+	return nil
+}
+
+// needsToken returns true if the operation requires a confirmation token.
+func (mpcli *MrPlotterCLIModule) needsToken(op string) bool {
+	_, ok := mpcli.tokenOps[op]
+	return ok
+}
+
+// confirmToken prints a short random token and returns true if the operator
+// types it back. When not interactive, it instead returns true only if
+// understood is set, from --i-understand. Nothing needs confirming when
+// changes are only being previewed.
+func (mpcli *MrPlotterCLIModule) confirmToken(output io.Writer, action string, understood bool) bool {
+	if mpcli.dryRun {
+		return true
+	}
+	if !mpcli.interactive {
+		if understood {
+			return true
+		}
+		writeStringf(mpcli.errWriter(output), "Not going to %s: it must be confirmed with a token (use %s in scripts)\n", action, understandFlag)
+		return false
+	}
+	random := make([]byte, 3)
+	if _, err := rand.Read(random); err != nil {
+		writeStringf(mpcli.errWriter(output), "Could not generate a confirmation token: %v\n", err)
+		return false
+	}
+	token := hex.EncodeToString(random)
+	writeStringf(mpcli.warnWriter(output), "To %s, type %s: ", action, token)
+	if mpcli.input.Scan() && strings.TrimSpace(mpcli.input.Text()) == token {
+		return true
+	}
+	writeStringf(mpcli.errWriter(output), "Confirmation token did not match; not going to %s\n", action)
+	return false
+}
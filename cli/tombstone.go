@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/immesys/smartgridstore/admincli"
+)
+
+// DefaultPurgeGrace is how long a deleted account can be restored before
+// purge removes it, if no grace period is given.
+const DefaultPurgeGrace = 7 * 24 * time.Hour
+
+func (mpcli *MrPlotterCLIModule) purgeCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "purge",
+		usageargs:   "[grace]",
+		hint:        fmt.Sprintf("permanently removes accounts deleted longer ago than the grace period (e.g. 72h; default %v)", DefaultPurgeGrace),
+		mutates:     true,
+		destructive: true,
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) <= 1; !argsOK {
+				return
+			}
+			grace := DefaultPurgeGrace
+			if len(tokens) == 1 {
+				var err error
+				grace, err = time.ParseDuration(tokens[0])
+				if err != nil || grace < 0 {
+					writeStringf(mpcli.errWriter(output), "Invalid grace period '%s'\n", tokens[0])
+					return
+				}
+			}
+			das, err := mpcli.store.RetrieveAllDeletedAccounts(ctx)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			cutoff := time.Now().Add(-grace)
+			purged := 0
+			for i, da := range das {
+				if da.DeletedAt.After(cutoff) {
+					continue
+				}
+				if !mpcli.pause(ctx, output, i, len(das)) {
+					return
+				}
+				err = mpcli.store.DeleteDeletedAccount(ctx, da.Username)
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				purged++
+			}
+			if purged == 1 {
+				writeStringln(mpcli.infoWriter(output), "Purged 1 deleted account")
+			} else {
+				writeStringf(mpcli.infoWriter(output), "Purged %v deleted accounts\n", purged)
+			}
+			return
+		},
+	}
+}
+
+func (mpcli *MrPlotterCLIModule) restoreUserCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "restore-user",
+		usageargs: "username",
+		hint:      "restores a deleted account that has not yet been purged",
+		mutates:   true,
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 1; !argsOK {
+				return
+			}
+			da, err := mpcli.store.RetrieveDeletedAccount(ctx, tokens[0])
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if da == nil {
+				writeStringf(mpcli.errWriter(output), "No deleted account named %s (it may have been purged)\n", tokens[0])
+				return
+			}
+
+			/* Only restore if the username has not been reused since. */
+			acc := da.Account()
+			success, err := mpcli.store.UpsertAccountAtomically(ctx, acc)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			if !success {
+				writeStringf(mpcli.errWriter(output), "%s: an account named %s has been created since it was deleted\n", alreadyExists, acc.Username)
+				return
+			}
+			err = mpcli.store.DeleteDeletedAccount(ctx, acc.Username)
+			if err != nil {
+				writeStringf(mpcli.warnWriter(output), "Warning: restored %s but could not remove its tombstone: %v\n", acc.Username, err)
+			}
+			return
+		},
+	}
+}
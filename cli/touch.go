@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+func (mpcli *MrPlotterCLIModule) touchCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:        "touch",
+		usageargs:   "username | [prefix] --all",
+		hint:        "marks an account, or with --all every account with a prefix, as modified now without changing anything else, e.g. to record that it was reviewed",
+		mutates:     true,
+		previewable: true,
+		flags:       []string{"--all"},
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			tokens, all := extractFlag(tokens, "--all")
+			if argsOK = len(tokens) == 1 || (all && len(tokens) == 0); !argsOK {
+				return
+			}
+			prefix := ""
+			if len(tokens) == 1 {
+				prefix = tokens[0]
+			}
+
+			if !all {
+				err := manage.TouchAccount(ctx, mpcli.store, prefix)
+				writeManageError(mpcli.errWriter(output), err)
+				return
+			}
+
+			var usernames []string
+			err := mpcli.store.ForEachAccount(ctx, prefix, func(acc *accounts.MrPlotterAccount) error {
+				usernames = append(usernames, acc.Username)
+				return nil
+			})
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+
+			touched := 0
+			for i, username := range usernames {
+				if !mpcli.pause(ctx, output, i, len(usernames)) {
+					break
+				}
+				/* TouchAccount rereads the account, so a retry keeps the other change. */
+				for attempt := 0; attempt < txAttempts; attempt++ {
+					err = manage.TouchAccount(ctx, mpcli.store, username)
+					if !errors.Is(err, manage.ErrTxFail) {
+						break
+					}
+				}
+				if errors.Is(err, manage.ErrAccountNotExists) {
+					continue
+				}
+				if writeManageError(mpcli.errWriter(output), err) {
+					break
+				}
+				touched++
+			}
+			if touched == 1 {
+				writeStringln(mpcli.infoWriter(output), "Touched 1 account")
+			} else {
+				writeStringf(mpcli.infoWriter(output), "Touched %d accounts\n", touched)
+			}
+			return
+		},
+	}
+}
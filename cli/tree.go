@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/immesys/smartgridstore/admincli"
+)
+
+// prefixTree is a tree of path prefixes split at the separator. A node is
+// granted if one of the prefixes ends there.
+type prefixTree struct {
+	children map[string]*prefixTree
+	granted  bool
+}
+
+func newPrefixTree() *prefixTree {
+	return &prefixTree{children: make(map[string]*prefixTree)}
+}
+
+// splitPrefix splits a prefix into its levels, keeping the separator at the
+// end of each level that has one.
+func splitPrefix(pfx string, sep string) []string {
+	if len(sep) == 0 {
+		return []string{pfx}
+	}
+	levels := strings.SplitAfter(pfx, sep)
+	if levels[len(levels)-1] == "" {
+		levels = levels[:len(levels)-1]
+	}
+	return levels
+}
+
+func buildPrefixTree(prefixes map[string]struct{}, sep string) *prefixTree {
+	root := newPrefixTree()
+	for pfx := range prefixes {
+		node := root
+		if len(pfx) != 0 {
+			for _, level := range splitPrefix(pfx, sep) {
+				child, ok := node.children[level]
+				if !ok {
+					child = newPrefixTree()
+					node.children[level] = child
+				}
+				node = child
+			}
+		}
+		node.granted = true
+	}
+	return root
+}
+
+// writeTree writes the tree with one level per line, indenting children
+// beneath their parents and marking granted prefixes with "*".
+func (t *prefixTree) writeTree(output io.Writer, indent string) {
+	levels := make([]string, 0, len(t.children))
+	for level := range t.children {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	for _, level := range levels {
+		child := t.children[level]
+		mark := ""
+		if child.granted {
+			mark = " *"
+		}
+		writeStringf(output, "%s%s%s\n", indent, level, mark)
+		child.writeTree(output, indent+"    ")
+	}
+}
+
+// writePrefixTree renders a set of prefixes as an indented tree.
+func (mpcli *MrPlotterCLIModule) writePrefixTree(output io.Writer, prefixes map[string]struct{}) {
+	tree := buildPrefixTree(prefixes, mpcli.prefixSep)
+	if tree.granted {
+		writeStringln(output, "(all collections) *")
+	}
+	tree.writeTree(output, "")
+}
+
+// writeAccessTree renders the prefixes that the given tags grant as a tree.
+func (mpcli *MrPlotterCLIModule) writeAccessTree(output io.Writer, r *resolver, tags map[string]struct{}) {
+	prefixes, err := r.prefixes(tags)
+	if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+		return
+	}
+	mpcli.writePrefixTree(output, prefixes)
+}
+
+func (mpcli *MrPlotterCLIModule) treeCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "tree",
+		usageargs: "[username]",
+		hint:      "shows the path prefixes visible to a user, or covered by any tag, as a tree in which granted prefixes are marked with *",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 0 || len(tokens) == 1; !argsOK {
+				return
+			}
+
+			r := mpcli.newResolver(ctx)
+			var tags map[string]struct{}
+			if len(tokens) == 1 {
+				acc, err := mpcli.store.RetrieveAccount(ctx, tokens[0])
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				if acc == nil {
+					writeStringln(mpcli.errWriter(output), accountNotExists)
+					return
+				}
+				tags = acc.Tags
+			} else {
+				err := r.preload()
+				if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+					return
+				}
+				tags = make(map[string]struct{}, len(r.tagdefs))
+				for tag := range r.tagdefs {
+					tags[tag] = struct{}{}
+				}
+			}
+			mpcli.writeAccessTree(output, r, tags)
+			return
+		},
+	}
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"unicode"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/immesys/smartgridstore/admincli"
+	"github.com/samkumar/mr-plotter-conf/manage"
+)
+
+// checkName returns an error if a username or tag is empty or contains
+// whitespace or control characters, which could not be typed as a single
+// argument or listed unambiguously.
+func checkName(kind string, name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("%s is empty", kind)
+	}
+	for _, r := range name {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return fmt.Errorf("%s %q contains whitespace or control characters", kind, name)
+		}
+	}
+	return nil
+}
+
+// readStreamDump reads every record of a file written by export --stream
+// into a single dump.
+func readStreamDump(path string) (*manage.Dump, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	dump := &manage.Dump{}
+	decoder := json.NewDecoder(file)
+	for n := 1; ; n++ {
+		var record manage.StreamRecord
+		err = decoder.Decode(&record)
+		if err == io.EOF {
+			return dump, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not decode record %d: %v", n, err)
+		}
+		switch {
+		case record.Type == manage.StreamAccount && record.DumpAccount != nil:
+			dump.Accounts = append(dump.Accounts, *record.DumpAccount)
+		case record.Type == manage.StreamTagDef && record.DumpTagDef != nil:
+			dump.TagDefs = append(dump.TagDefs, *record.DumpTagDef)
+		default:
+			return nil, fmt.Errorf("record %d has unknown type '%s'", n, record.Type)
+		}
+	}
+}
+
+// dumpProblems returns every reason that a dump would not make a valid
+// configuration, tag definitions first.
+func dumpProblems(dump *manage.Dump) []error {
+	var problems []error
+	defined := make(map[string]struct{}, len(dump.TagDefs))
+	for i := range dump.TagDefs {
+		dt := &dump.TagDefs[i]
+		if err := checkName("tag", dt.Tag); err != nil {
+			problems = append(problems, err)
+		}
+		if _, ok := defined[dt.Tag]; ok {
+			problems = append(problems, fmt.Errorf("tag '%s' is defined more than once", dt.Tag))
+		}
+		defined[dt.Tag] = struct{}{}
+		problems = append(problems, tagDefProblems(dt)...)
+	}
+
+	seen := make(map[string]struct{}, len(dump.Accounts))
+	for _, da := range dump.Accounts {
+		if err := checkName("username", da.Username); err != nil {
+			problems = append(problems, err)
+		}
+		if _, ok := seen[da.Username]; ok {
+			problems = append(problems, fmt.Errorf("account %s appears more than once", da.Username))
+		}
+		seen[da.Username] = struct{}{}
+		hasPublic := false
+		var undefined []string
+		for _, tag := range da.Tags {
+			if err := checkName("tag", tag); err != nil {
+				problems = append(problems, fmt.Errorf("account %s: %v", da.Username, err))
+				continue
+			}
+			if tag == accounts.PublicTag {
+				hasPublic = true
+			} else if _, ok := defined[tag]; !ok && tag != accounts.AllTag {
+				undefined = append(undefined, tag)
+			}
+		}
+		if !hasPublic {
+			problems = append(problems, fmt.Errorf("account %s lacks the \"%s\" tag", da.Username, accounts.PublicTag))
+		}
+		sort.Strings(undefined)
+		for _, tag := range undefined {
+			problems = append(problems, fmt.Errorf("account %s holds tag %s, which the file does not define", da.Username, tag))
+		}
+	}
+	return problems
+}
+
+func (mpcli *MrPlotterCLIModule) validateCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "validate",
+		usageargs: "[--format json|yaml] file",
+		hint:      "checks that a file written by export, with or without --stream, would make a valid configuration, reporting every problem without importing anything",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			tokens, format, argsOK := extractOption(tokens, "--format")
+			if argsOK = argsOK && len(tokens) == 1; !argsOK {
+				return
+			}
+			stream, err := isStreamFile(tokens[0], format)
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			dump := &manage.Dump{}
+			if stream {
+				dump, err = readStreamDump(tokens[0])
+			} else {
+				err = decodeFileFormat(tokens[0], format, dump)
+			}
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			problems := dumpProblems(dump)
+			for _, problem := range problems {
+				writeStringln(mpcli.errWriter(output), problem.Error())
+			}
+			writeStringf(mpcli.infoWriter(output), "Checked %d accounts and %d tag definitions: %d problems\n", len(dump.Accounts), len(dump.TagDefs), len(problems))
+			return
+		},
+	}
+}
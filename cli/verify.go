@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package cli
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/immesys/smartgridstore/admincli"
+)
+
+func (mpcli *MrPlotterCLIModule) verifyCommand() admincli.CLIModule {
+	return &MrPlotterCommand{
+		name:      "verify",
+		usageargs: "",
+		hint:      "checks that every account and tag definition decodes, reporting each that does not as an error",
+		exec: func(ctx context.Context, output io.Writer, tokens ...string) (argsOK bool) {
+			if argsOK = len(tokens) == 0; !argsOK {
+				return
+			}
+			tagdefs, err := mpcli.store.RetrieveMultipleTagDefs(ctx, "")
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+			accs, err := mpcli.store.RetrieveMultipleAccounts(ctx, "")
+			if waserr, _ := writeError(mpcli.errWriter(output), err); waserr {
+				return
+			}
+
+			problems := 0
+			corrupt := make(map[string]struct{})
+			for _, tagdef := range tagdefs {
+				if tagdef.PathPrefix == nil {
+					writeStringf(mpcli.errWriter(output), "Tag definition %s is corrupt\n", tagdef.Tag)
+					corrupt[tagdef.Tag] = struct{}{}
+					problems++
+				}
+			}
+			for _, acc := range accs {
+				if acc.Tags == nil {
+					writeStringf(mpcli.errWriter(output), "Account %s is corrupt\n", acc.Username)
+					problems++
+					continue
+				}
+				var held []string
+				for tag := range acc.Tags {
+					if _, ok := corrupt[tag]; ok {
+						held = append(held, tag)
+					}
+				}
+				sort.Strings(held)
+				for _, tag := range held {
+					writeStringf(mpcli.errWriter(output), "Account %s holds tag %s, whose definition is corrupt\n", acc.Username, tag)
+					problems++
+				}
+			}
+			writeStringf(mpcli.infoWriter(output), "Checked %d accounts and %d tag definitions: %d problems\n", len(accs), len(tagdefs), problems)
+			return
+		},
+	}
+}
@@ -21,7 +21,7 @@ func main() {
 	}
 	etcdClient, err := etcd.New(etcd.Config{Endpoints: []string{etcdEndpoint}})
 	if err != nil {
-		fmt.Printf("Could not connect to etcd: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Could not connect to etcd: %v\n", err)
 		os.Exit(1)
 	}
 
@@ -34,7 +34,7 @@ func main() {
 
 	err = accounts.UpsertTagDef(context.Background(), etcdClient, tdef)
 	if err != nil {
-		fmt.Printf("Could not update tag 'public': %v\n", err)
+		fmt.Fprintf(os.Stderr, "Could not update tag 'public': %v\n", err)
 		os.Exit(2)
 	}
 
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/samkumar/mr-plotter-conf/cli"
+	"github.com/samkumar/mr-plotter-conf/logging"
+
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// history holds the commands run in this REPL session, exactly as typed, so
+// that "!N" can run one again. It is never written to disk.
+var history []string
+
+// displayCommand formats a command for the history listing, with the secret
+// arguments of commands that have them, such as passwords, redacted.
+func displayCommand(cmd string) string {
+	tokens, quoted, err := splitQuotedCommand(cmd)
+	if err != nil || len(tokens) == 0 {
+		return cmd
+	}
+	tokens, path, appendMode, err := parseRedirect(tokens, quoted)
+	if err != nil || len(tokens) == 0 {
+		return cmd
+	}
+	opcode := tokens[0]
+	if command, ok := aliases[opcode]; ok {
+		opcode = command
+	}
+	args := tokens[1:]
+	if op, ok := ops[opcode]; ok {
+		args = cli.RedactArgs(op, args)
+	}
+	line := make([]string, 0, len(args)+3)
+	line = append(line, tokens[0])
+	for _, arg := range args {
+		if len(arg) == 0 || strings.ContainsAny(arg, " \t\"'\\>") {
+			arg = strconv.Quote(arg)
+		}
+		line = append(line, arg)
+	}
+	if len(path) != 0 {
+		if appendMode {
+			line = append(line, ">>", path)
+		} else {
+			line = append(line, ">", path)
+		}
+	}
+	return strings.Join(line, " ")
+}
+
+// writeHistory lists the commands run in this session with their numbers.
+func writeHistory(output io.Writer) {
+	for i, cmd := range history {
+		fmt.Fprintf(output, "%5d  %s\n", i+1, displayCommand(cmd))
+	}
+}
+
+// sessionExec runs a command typed at the REPL. "!N" runs the Nth command of
+// the session again, and every command that can be parsed is added to the
+// history.
+func sessionExec(etcdClient *etcd.Client, cmd string) bool {
+	trimmed := strings.TrimSpace(cmd)
+	if strings.HasPrefix(trimmed, "!") {
+		n, err := strconv.Atoi(trimmed[1:])
+		if err != nil || n < 1 || n > len(history) {
+			logging.Errorf("No command %s in history", trimmed)
+			return false
+		}
+		cmd = history[n-1]
+		fmt.Fprintln(os.Stderr, displayCommand(cmd))
+	}
+	if tokens, err := splitCommand(cmd); err == nil && len(tokens) != 0 && !strings.HasPrefix(tokens[0], "#") {
+		history = append(history, cmd)
+	}
+	return accountsExec(etcdClient, cmd)
+}
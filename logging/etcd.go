@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package logging
+
+import (
+	"context"
+	"time"
+
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// loggingKV logs each etcd request made through it, and how long it took, at
+// the debug level. Requests it does not override pass straight through.
+type loggingKV struct {
+	etcd.KV
+}
+
+// WrapKV returns a KV that logs every request made through it at the debug
+// level, for installing in an etcd client with client.KV = WrapKV(client.KV).
+// This covers the requests made by the accounts package as well as this
+// tool's own.
+func WrapKV(kv etcd.KV) etcd.KV {
+	return &loggingKV{kv}
+}
+
+func logRequest(op string, key string, start time.Time, err error) {
+	if err != nil {
+		Debugf("etcd %s %s failed after %v: %v", op, key, time.Since(start), err)
+	} else {
+		Debugf("etcd %s %s took %v", op, key, time.Since(start))
+	}
+}
+
+func (kv *loggingKV) Put(ctx context.Context, key, val string, opts ...etcd.OpOption) (*etcd.PutResponse, error) {
+	start := time.Now()
+	resp, err := kv.KV.Put(ctx, key, val, opts...)
+	logRequest("put", key, start, err)
+	return resp, err
+}
+
+func (kv *loggingKV) Get(ctx context.Context, key string, opts ...etcd.OpOption) (*etcd.GetResponse, error) {
+	start := time.Now()
+	resp, err := kv.KV.Get(ctx, key, opts...)
+	logRequest("get", key, start, err)
+	return resp, err
+}
+
+func (kv *loggingKV) Delete(ctx context.Context, key string, opts ...etcd.OpOption) (*etcd.DeleteResponse, error) {
+	start := time.Now()
+	resp, err := kv.KV.Delete(ctx, key, opts...)
+	logRequest("delete", key, start, err)
+	return resp, err
+}
+
+func (kv *loggingKV) Txn(ctx context.Context) etcd.Txn {
+	return &loggingTxn{kv.KV.Txn(ctx)}
+}
+
+// loggingTxn logs the commit of a transaction. The keys it touches are not
+// visible through the Txn interface, so only its outcome is logged.
+type loggingTxn struct {
+	txn etcd.Txn
+}
+
+func (t *loggingTxn) If(cs ...etcd.Cmp) etcd.Txn {
+	t.txn = t.txn.If(cs...)
+	return t
+}
+
+func (t *loggingTxn) Then(ops ...etcd.Op) etcd.Txn {
+	t.txn = t.txn.Then(ops...)
+	return t
+}
+
+func (t *loggingTxn) Else(ops ...etcd.Op) etcd.Txn {
+	t.txn = t.txn.Else(ops...)
+	return t
+}
+
+func (t *loggingTxn) Commit() (*etcd.TxnResponse, error) {
+	start := time.Now()
+	resp, err := t.txn.Commit()
+	if err != nil {
+		Debugf("etcd txn failed after %v: %v", time.Since(start), err)
+	} else {
+		Debugf("etcd txn took %v (succeeded: %v)", time.Since(start), resp.Succeeded)
+	}
+	return resp, err
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+// Package logging writes the configuration tool's diagnostics, as opposed to
+// the results of its commands, to standard error, filtered by level.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Level is the severity of a diagnostic message.
+type Level int
+
+// The levels, from most to least verbose.
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (level Level) String() string {
+	if level < Debug || level > Error {
+		return fmt.Sprintf("level(%d)", int(level))
+	}
+	return levelNames[level]
+}
+
+// ParseLevel returns the level with the given name.
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return Info, fmt.Errorf("unknown log level '%s' (expected one of %s)", name, strings.Join(levelNames, ", "))
+}
+
+var (
+	lock   sync.Mutex
+	level            = Info
+	output io.Writer = os.Stderr
+)
+
+// SetLevel sets the least severe level that is written. It is Info by
+// default.
+func SetLevel(l Level) {
+	lock.Lock()
+	defer lock.Unlock()
+	level = l
+}
+
+// SetOutput sets the writer to which messages are written. It is standard
+// error by default.
+func SetOutput(w io.Writer) {
+	lock.Lock()
+	defer lock.Unlock()
+	output = w
+}
+
+// Enabled returns true if messages of the given level are written.
+func Enabled(l Level) bool {
+	lock.Lock()
+	defer lock.Unlock()
+	return l >= level
+}
+
+// logf writes a message if its level is enabled, adding a newline if it
+// lacks one. Debug messages are marked as such, so they stand out among the
+// others.
+func logf(l Level, format string, a ...interface{}) {
+	lock.Lock()
+	defer lock.Unlock()
+	if l < level {
+		return
+	}
+	message := fmt.Sprintf(format, a...)
+	if l == Debug {
+		message = "debug: " + message
+	}
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+	io.WriteString(output, message)
+}
+
+// Debugf writes a message that is only of use when diagnosing a problem.
+func Debugf(format string, a ...interface{}) {
+	logf(Debug, format, a...)
+}
+
+// Infof writes an informational message.
+func Infof(format string, a ...interface{}) {
+	logf(Info, format, a...)
+}
+
+// Warnf writes a warning.
+func Warnf(format string, a ...interface{}) {
+	logf(Warn, format, a...)
+}
+
+// Errorf writes an error. Errors are written at every level.
+func Errorf(format string, a ...interface{}) {
+	logf(Error, format, a...)
+}
@@ -31,88 +31,526 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
-	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
 	"github.com/immesys/smartgridstore/admincli"
 	"github.com/samkumar/mr-plotter-conf/cli"
+	"github.com/samkumar/mr-plotter-conf/logging"
+	"github.com/samkumar/mr-plotter-conf/manage"
 
 	etcd "github.com/coreos/etcd/clientv3"
+	btrdb "gopkg.in/btrdb.v4"
 )
 
-var mpcli admincli.CLIModule
+var mpcli *cli.MrPlotterCLIModule
 var ops = make(map[string]admincli.CLIModule)
 
+var writeRate = flag.Float64("write-rate", envFloat("MRPLOTTER_WRITE_RATE"), "maximum etcd writes per second for bulk commands (0 for no limit; defaults to $MRPLOTTER_WRITE_RATE)")
+var btrdbEndpoint = flag.String("btrdb", "", "host:port of a BTrDB endpoint, for commands that check the configuration against existing collections")
+var allowedPrefixes = flag.String("allowed-prefixes", os.Getenv("MRPLOTTER_ALLOWED_PREFIXES"), "file of known collection prefixes, one per line, outside which deftag and addprefix refuse prefixes without --force (defaults to $MRPLOTTER_ALLOWED_PREFIXES)")
+var aliasFile = flag.String("aliases", os.Getenv("MRPLOTTER_ALIASES"), "file of \"alias command\" lines defining additional command aliases (defaults to $MRPLOTTER_ALIASES)")
+var lock = flag.Bool("lock", false, "hold a lock in etcd while changing the configuration, so that concurrent sessions take turns")
+var dryRun = flag.Bool("dry-run", false, "print the changes that commands would make to the configuration without making them")
+var snapshot = flag.Bool("snapshot", false, "make each command that only reads the configuration read all of it at a single etcd revision")
+var metricsAddr = flag.String("metrics", "", "address, such as :9090, at which to serve statistics about the configuration to Prometheus instead of reading commands")
+var recordFile = flag.String("record", "", "file to which each successful command that changes the configuration is appended, for use with replay")
+var verifyCacheTTL = flag.Duration("verify-cache-ttl", 0, "how long checkpassword remembers a correct password, e.g. 30s (0, the default, disables caching)")
+var logLevel = flag.String("log-level", envString("MRPLOTTER_LOG_LEVEL", "info"), "least severe diagnostics to print: debug, info, warn, or error (defaults to $MRPLOTTER_LOG_LEVEL, or info)")
+var verbose = flag.Bool("v", false, "print debug diagnostics, including every etcd request and its latency; the same as --log-level debug")
+var tokenOps = flag.String("confirm-token", envString("MRPLOTTER_CONFIRM_TOKEN", strings.Join(cli.DefaultTokenOperations, ",")), "comma-separated operations that must be confirmed by typing a random token: all-tag, rmusers-all, or neither if empty (defaults to $MRPLOTTER_CONFIRM_TOKEN, or both)")
+var quiet = flag.Bool("quiet", false, "suppress informational output; only results and errors are printed")
+var timeout = flag.Duration("timeout", 0, "maximum time each command may take, e.g. 10s (0 for no limit)")
+var foldCase = flag.Bool("case-insensitive-usernames", false, "lowercase new usernames and reject ones that differ from an existing username only by case")
+var prefixSep = flag.String("separator", cli.DefaultPrefixSeparator, "separator that path prefixes should end with (empty to disable the check)")
+var appendSep = flag.Bool("append-separator", false, "append the separator to new path prefixes that lack it, instead of only warning")
+
+// envFloat returns the value of a numeric environment variable, or zero if it
+// is unset or invalid.
+func envFloat(name string) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// envString returns the value of an environment variable, or def if it is
+// unset.
+func envString(name string, def string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return def
+}
+
+func envInt(name string) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// splitList splits a comma-separated list, ignoring empty elements.
+func splitList(list string) []string {
+	var elems []string
+	for _, elem := range strings.Split(list, ",") {
+		if elem = strings.TrimSpace(elem); len(elem) != 0 {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
+
+// commandList collects the commands given with repeated -e flags.
+type commandList []string
+
+func (cl *commandList) String() string {
+	return strings.Join(*cl, "; ")
+}
+
+func (cl *commandList) Set(cmd string) error {
+	*cl = append(*cl, cmd)
+	return nil
+}
+
+var commands commandList
+
+func init() {
+	flag.Var(&commands, "e", "run a command and exit instead of starting the REPL (may be repeated; stops at the first failure)")
+}
+
 func main() {
+	flag.Parse()
+
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		logging.Errorf("%v", err)
+		os.Exit(1)
+	}
+	if *verbose {
+		level = logging.Debug
+	}
+	logging.SetLevel(level)
+
 	etcdEndpoint := os.Getenv("ETCD_ENDPOINT")
 	if len(etcdEndpoint) == 0 {
 		etcdEndpoint = "localhost:2379"
 	}
+	environment := os.Getenv("MRPLOTTER_ENV")
+	prompt := "Mr. Plotter> "
+	if len(environment) != 0 {
+		prompt = fmt.Sprintf("!!! %s !!! Mr. Plotter> ", strings.ToUpper(environment))
+		logging.Warnf("WARNING: this is the %s environment; destructive commands must be confirmed", environment)
+	}
+
 	etcdKeyPrefix := os.Getenv("ETCD_KEY_PREFIX")
 	if len(etcdKeyPrefix) != 0 {
-		accounts.SetEtcdKeyPrefix(etcdKeyPrefix)
-		fmt.Printf("Using Mr. Plotter configuration '%s'\n", etcdKeyPrefix)
+		manage.SetEtcdKeyPrefix(etcdKeyPrefix)
+		if !*quiet {
+			logging.Infof("Using Mr. Plotter configuration '%s'", etcdKeyPrefix)
+		}
 	}
+	logging.Debugf("connecting to etcd at %s", etcdEndpoint)
 	etcdClient, err := etcd.New(etcd.Config{Endpoints: []string{etcdEndpoint}})
 	if err != nil {
-		fmt.Printf("Could not connect to etcd: %v\n", err)
+		logging.Errorf("Could not connect to etcd: %v", err)
 		os.Exit(1)
 	}
+	if logging.Enabled(logging.Debug) {
+		etcdClient.KV = logging.WrapKV(etcdClient.KV)
+	}
+
+	var btrdbClient *btrdb.BTrDB
+	if len(*btrdbEndpoint) != 0 {
+		btrdbClient, err = btrdb.Connect(context.Background(), *btrdbEndpoint)
+		if err != nil {
+			logging.Errorf("Could not connect to BTrDB: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	/* Commands share the REPL's scanner when they read extra input. */
+	scanner := bufio.NewScanner(os.Stdin)
 
 	mpcli = cli.NewMrPlotterCLIModule(etcdClient)
+	mpcli.SetInput(scanner)
+	mpcli.SetBTrDB(btrdbClient)
+	mpcli.SetErrorOutput(os.Stderr)
+	mpcli.SetQuiet(*quiet)
+	mpcli.SetWriteRate(*writeRate)
+	mpcli.SetLocking(*lock)
+	mpcli.SetDryRun(*dryRun)
+	mpcli.SetSnapshotReads(*snapshot)
+	mpcli.SetVerifyCacheTTL(*verifyCacheTTL)
+	mpcli.SetPrefixSeparator(*prefixSep, *appendSep)
+	mpcli.SetCaseInsensitiveUsernames(*foldCase)
+	mpcli.SetOperator(os.Getenv("MRPLOTTER_OPERATOR"))
+	mpcli.SetEnvironment(environment)
+	mpcli.SetLimits(envInt("MRPLOTTER_MAX_TAGS"), envInt("MRPLOTTER_MAX_PREFIXES"))
+	if err := mpcli.SetTokenOperations(splitList(*tokenOps)); err != nil {
+		logging.Errorf("Invalid --confirm-token: %v", err)
+		os.Exit(1)
+	}
+	if err := mpcli.SetAllowedPrefixes(*allowedPrefixes); err != nil {
+		logging.Errorf("Could not read allowed prefixes: %v", err)
+		os.Exit(1)
+	}
+	if len(*recordFile) != 0 {
+		recorder, err := os.OpenFile(*recordFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			logging.Errorf("Could not open record file: %v", err)
+			os.Exit(1)
+		}
+		defer recorder.Close()
+		mpcli.SetRecorder(recorder)
+	}
+	mpcli.SetInteractive(len(commands) == 0 && isTerminal(os.Stdin))
 	cmds := mpcli.Children()
 	for _, cmd := range cmds {
 		ops[cmd.Name()] = cmd
 	}
+	if err := loadAliases(*aliasFile); err != nil {
+		logging.Errorf("Could not load aliases: %v", err)
+		os.Exit(1)
+	}
+
+	/* Serve metrics instead of reading commands, if asked to. */
+	if len(*metricsAddr) != 0 {
+		if len(commands) != 0 {
+			logging.Errorf("--metrics cannot be combined with -e")
+			os.Exit(1)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", mpcli.MetricsHandler())
+		logging.Infof("Serving metrics at %s/metrics", *metricsAddr)
+		logging.Errorf("Could not serve metrics: %v", http.ListenAndServe(*metricsAddr, mux))
+		os.Exit(1)
+	}
+
+	/* Run the commands given with -e instead of the REPL, if any. */
+	if len(commands) != 0 {
+		for _, cmd := range commands {
+			if !accountsExec(etcdClient, cmd) {
+				os.Exit(1)
+			}
+		}
+		return
+	}
 
 	/* Start the REPL. */
-	scanner := bufio.NewScanner(os.Stdin)
 	for {
-		fmt.Print("Mr. Plotter> ")
-		if !scanner.Scan() {
+		result, ok := readCommand(scanner, prompt)
+		if !ok {
 			break
 		}
-		result := scanner.Text()
-		accountsExec(etcdClient, result)
+		sessionExec(etcdClient, result)
 	}
 
-	fmt.Println()
+	if !*quiet {
+		fmt.Println()
+	}
 	if err := scanner.Err(); err != nil {
-		fmt.Printf("Exiting: %v\n", err)
+		logging.Errorf("Exiting: %v", err)
 	}
 }
 
-func help() {
+// continuationPrompt is shown while reading a command continued from the
+// previous line.
+const continuationPrompt = "> "
+
+// continues returns true if a line ends with a backslash that is not itself
+// escaped, so that the command continues on the next line.
+func continues(line string) bool {
+	trailing := len(line) - len(strings.TrimRight(line, "\\"))
+	return trailing%2 == 1
+}
+
+// readCommand reads a command from the REPL's input, prompting for it. A
+// line ending with a backslash continues the command on the next line; the
+// lines are joined with a space in place of the backslash. It returns false
+// at the end of the input, after reporting a command left incomplete.
+func readCommand(scanner *bufio.Scanner, prompt string) (string, bool) {
+	var cmd strings.Builder
+	continued := false
+	for {
+		if !*quiet {
+			fmt.Print(prompt)
+		}
+		if !scanner.Scan() {
+			if continued {
+				logging.Errorf("Discarding incomplete command: the input ended after a line ending with '\\'")
+			}
+			return "", false
+		}
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if !continues(line) {
+			cmd.WriteString(line)
+			return cmd.String(), true
+		}
+		cmd.WriteString(line[:len(line)-1])
+		cmd.WriteString(" ")
+		continued = true
+		prompt = continuationPrompt
+	}
+}
+
+// isTerminal returns true if the file is a terminal rather than a pipe or a
+// regular file.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func help(output io.Writer) {
 	commands := make([]string, 0, len(ops))
 	for _, cmd := range mpcli.Children() {
-		commands = append(commands, cmd.Name())
+		name := cmd.Name()
+		if names := aliasesFor(name); len(names) != 0 {
+			name = fmt.Sprintf("%s (%s)", name, strings.Join(names, ", "))
+		}
+		commands = append(commands, name)
+	}
+	fmt.Fprintln(output, "Type one of the following commands and press <Enter> or <Return> to execute it:")
+	commands = append(commands, "replay", "history")
+	fmt.Fprintln(output, strings.Join(commands, " "))
+}
+
+// replaying is true while replay is running the commands in a file.
+var replaying bool
+
+// replay runs the commands in a file written with --record, in order. It
+// stops at the first command that fails unless --continue is given, and
+// returns false if any failed. A replayed file cannot itself run replay,
+// since a file that replays itself would never finish.
+func replay(etcdClient *etcd.Client, args []string) bool {
+	if replaying {
+		logging.Errorf("replay cannot be run from a file that is being replayed")
+		return false
+	}
+	keepGoing := len(args) != 0 && args[0] == "--continue"
+	if keepGoing {
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		logging.Errorf("Usage: replay [--continue] file")
+		return false
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		logging.Errorf("Could not open replay file: %v", err)
+		return false
+	}
+	defer file.Close()
+	replaying = true
+	defer func() {
+		replaying = false
+	}()
+	ok := true
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		cmd := strings.TrimSpace(scanner.Text())
+		if len(cmd) == 0 || strings.HasPrefix(cmd, "#") {
+			continue
+		}
+		if accountsExec(etcdClient, cmd) {
+			continue
+		}
+		ok = false
+		if !keepGoing {
+			logging.Errorf("Stopped replaying at line %d: %s", line, cmd)
+			return false
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		logging.Errorf("Could not read replay file: %v", err)
+		return false
+	}
+	return ok
+}
+
+// splitCommand splits a command into tokens at whitespace. Single or double
+// quotes group text containing whitespace into one token; within double
+// quotes, a backslash escapes the next character.
+func splitCommand(cmd string) ([]string, error) {
+	tokens, _, err := splitQuotedCommand(cmd)
+	return tokens, err
+}
+
+// splitQuotedCommand splits a command like splitCommand, and also reports,
+// for each token, whether it begins with quoted text. A quoted ">" is an
+// argument rather than a redirection.
+func splitQuotedCommand(cmd string) ([]string, []bool, error) {
+	var tokens []string
+	var quoted []bool
+	var token strings.Builder
+	inToken := false
+	startsQuoted := false
+	var quote rune
+	escaped := false
+	for _, c := range cmd {
+		switch {
+		case escaped:
+			token.WriteRune(c)
+			escaped = false
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0:
+			token.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote = c
+			if !inToken {
+				startsQuoted = true
+			}
+			inToken = true
+		case unicode.IsSpace(c):
+			if inToken {
+				tokens = append(tokens, token.String())
+				quoted = append(quoted, startsQuoted)
+				token.Reset()
+				inToken = false
+				startsQuoted = false
+			}
+		default:
+			token.WriteRune(c)
+			inToken = true
+		}
 	}
-	fmt.Println("Type one of the following commands and press <Enter> or <Return> to execute it:")
-	fmt.Println(strings.Join(commands, " "))
+	if quote != 0 || escaped {
+		return nil, nil, errors.New("unterminated quotation")
+	}
+	if inToken {
+		tokens = append(tokens, token.String())
+		quoted = append(quoted, startsQuoted)
+	}
+	return tokens, quoted, nil
+}
+
+// parseRedirect removes a trailing "> file" or ">> file" from the tokens,
+// where quoted reports which tokens begin with quoted text, as returned by
+// splitQuotedCommand; only unquoted tokens can start a redirection. It
+// returns the remaining tokens, the file to write output to (empty if there
+// is none), and whether the file should be appended to instead of truncated.
+func parseRedirect(tokens []string, quoted []bool) ([]string, string, bool, error) {
+	for i, token := range tokens {
+		if quoted[i] || !strings.HasPrefix(token, ">") {
+			continue
+		}
+		appendMode := strings.HasPrefix(token, ">>")
+		path := strings.TrimPrefix(strings.TrimPrefix(token, ">"), ">")
+		rest := tokens[i+1:]
+		if len(path) == 0 && len(rest) != 0 {
+			path = rest[0]
+			rest = rest[1:]
+		}
+		if len(path) == 0 || len(rest) != 0 {
+			return nil, "", false, errors.New("redirection must be \"> file\" or \">> file\" at the end of the command")
+		}
+		return tokens[:i], path, appendMode, nil
+	}
+	return tokens, "", false, nil
 }
 
-func accountsExec(etcdClient *etcd.Client, cmd string) {
-	tokens := strings.Fields(cmd)
+// accountsExec runs a command, returning false if it was invalid or failed.
+func accountsExec(etcdClient *etcd.Client, cmd string) bool {
+	if strings.HasPrefix(strings.TrimSpace(cmd), "#") {
+		return true
+	}
+	tokens, quoted, err := splitQuotedCommand(cmd)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return false
+	}
 	if len(tokens) == 0 {
-		return
+		return true
+	}
+
+	tokens, path, appendMode, err := parseRedirect(tokens, quoted)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return false
+	}
+	var output io.Writer = os.Stdout
+	if len(path) != 0 {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if appendMode {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		file, err := os.OpenFile(path, flags, 0644)
+		if err != nil {
+			logging.Errorf("Could not open output file: %v", err)
+			return false
+		}
+		defer file.Close()
+		output = file
+	}
+	if len(tokens) == 0 {
+		return true
 	}
 
 	opcode := tokens[0]
+	if command, ok := aliases[opcode]; ok {
+		opcode = command
+	}
 
 	if opcode == "help" {
-		help()
-		return
+		help(output)
+		return true
+	}
+
+	if opcode == "replay" {
+		return replay(etcdClient, tokens[1:])
+	}
+
+	if opcode == "history" {
+		writeHistory(output)
+		return true
 	}
 
 	if op, ok := ops[opcode]; ok {
-		argsOK := op.Run(context.Background(), os.Stdout, tokens[1:]...)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if *timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+
+		/* Ctrl-C cancels the running command rather than exiting. */
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		defer signal.Stop(interrupt)
+		go func() {
+			select {
+			case <-interrupt:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		mpcli.ClearFailed()
+		start := time.Now()
+		argsOK := op.Run(ctx, output, tokens[1:]...)
+		logging.Debugf("%s took %v", opcode, time.Since(start))
 		if !argsOK {
-			fmt.Printf("Usage: %s%s", op.Name(), op.Usage())
+			logging.Errorf("Usage: %s%s", op.Name(), op.Usage())
 		}
-	} else {
-		fmt.Printf("'%s' is not a valid command\n", opcode)
-		help()
+		return argsOK && !mpcli.Failed()
+	}
+
+	logging.Errorf("'%s' is not a valid command", opcode)
+	if !*quiet {
+		help(os.Stderr)
 	}
+	return false
 }
@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package manage
+
+import (
+	"sort"
+)
+
+// AccountDiff describes how an account differs between two dumps.
+type AccountDiff struct {
+	Username        string
+	AddedTags       []string
+	RemovedTags     []string
+	PasswordChanged bool
+}
+
+// TagDefDiff describes how a tag definition differs between two dumps.
+type TagDefDiff struct {
+	Tag             string
+	AddedPrefixes   []string
+	RemovedPrefixes []string
+}
+
+// DumpDiff describes the changes that turn one dump into another. Added
+// records are only in the new dump, and removed records are only in the old
+// one. Every list is sorted by name.
+type DumpDiff struct {
+	AddedAccounts    []string
+	RemovedAccounts  []string
+	ModifiedAccounts []AccountDiff
+	AddedTagDefs     []string
+	RemovedTagDefs   []string
+	ModifiedTagDefs  []TagDefDiff
+}
+
+// Empty returns true if the two dumps were the same.
+func (dd *DumpDiff) Empty() bool {
+	return len(dd.AddedAccounts) == 0 && len(dd.RemovedAccounts) == 0 && len(dd.ModifiedAccounts) == 0 &&
+		len(dd.AddedTagDefs) == 0 && len(dd.RemovedTagDefs) == 0 && len(dd.ModifiedTagDefs) == 0
+}
+
+// diffSets returns the sorted elements only in newSlice and only in
+// oldSlice.
+func diffSets(oldSlice []string, newSlice []string) ([]string, []string) {
+	oldSet := keySet(oldSlice)
+	newSet := keySet(newSlice)
+	var added, removed []string
+	for elem := range newSet {
+		if _, ok := oldSet[elem]; !ok {
+			added = append(added, elem)
+		}
+	}
+	for elem := range oldSet {
+		if _, ok := newSet[elem]; !ok {
+			removed = append(removed, elem)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// DiffAccounts compares two versions of the same account.
+func DiffAccounts(oldAcc *DumpAccount, newAcc *DumpAccount) AccountDiff {
+	ad := AccountDiff{Username: newAcc.Username, PasswordChanged: oldAcc.PasswordHash != newAcc.PasswordHash}
+	ad.AddedTags, ad.RemovedTags = diffSets(oldAcc.Tags, newAcc.Tags)
+	return ad
+}
+
+// DiffDumps compares two dumps, field by field.
+func DiffDumps(oldDump *Dump, newDump *Dump) *DumpDiff {
+	dd := &DumpDiff{}
+
+	oldAccounts := make(map[string]*DumpAccount, len(oldDump.Accounts))
+	for i := range oldDump.Accounts {
+		oldAccounts[oldDump.Accounts[i].Username] = &oldDump.Accounts[i]
+	}
+	newAccounts := make(map[string]*DumpAccount, len(newDump.Accounts))
+	for i := range newDump.Accounts {
+		newAccounts[newDump.Accounts[i].Username] = &newDump.Accounts[i]
+	}
+	for username, newAcc := range newAccounts {
+		oldAcc, ok := oldAccounts[username]
+		if !ok {
+			dd.AddedAccounts = append(dd.AddedAccounts, username)
+			continue
+		}
+		ad := DiffAccounts(oldAcc, newAcc)
+		if len(ad.AddedTags) != 0 || len(ad.RemovedTags) != 0 || ad.PasswordChanged {
+			dd.ModifiedAccounts = append(dd.ModifiedAccounts, ad)
+		}
+	}
+	for username := range oldAccounts {
+		if _, ok := newAccounts[username]; !ok {
+			dd.RemovedAccounts = append(dd.RemovedAccounts, username)
+		}
+	}
+
+	oldTagDefs := make(map[string]*DumpTagDef, len(oldDump.TagDefs))
+	for i := range oldDump.TagDefs {
+		oldTagDefs[oldDump.TagDefs[i].Tag] = &oldDump.TagDefs[i]
+	}
+	newTagDefs := make(map[string]*DumpTagDef, len(newDump.TagDefs))
+	for i := range newDump.TagDefs {
+		newTagDefs[newDump.TagDefs[i].Tag] = &newDump.TagDefs[i]
+	}
+	for tag, newDef := range newTagDefs {
+		oldDef, ok := oldTagDefs[tag]
+		if !ok {
+			dd.AddedTagDefs = append(dd.AddedTagDefs, tag)
+			continue
+		}
+		td := TagDefDiff{Tag: tag}
+		td.AddedPrefixes, td.RemovedPrefixes = diffSets(oldDef.Prefixes, newDef.Prefixes)
+		if len(td.AddedPrefixes) != 0 || len(td.RemovedPrefixes) != 0 {
+			dd.ModifiedTagDefs = append(dd.ModifiedTagDefs, td)
+		}
+	}
+	for tag := range oldTagDefs {
+		if _, ok := newTagDefs[tag]; !ok {
+			dd.RemovedTagDefs = append(dd.RemovedTagDefs, tag)
+		}
+	}
+
+	sort.Strings(dd.AddedAccounts)
+	sort.Strings(dd.RemovedAccounts)
+	sort.Slice(dd.ModifiedAccounts, func(i, j int) bool {
+		return dd.ModifiedAccounts[i].Username < dd.ModifiedAccounts[j].Username
+	})
+	sort.Strings(dd.AddedTagDefs)
+	sort.Strings(dd.RemovedTagDefs)
+	sort.Slice(dd.ModifiedTagDefs, func(i, j int) bool {
+		return dd.ModifiedTagDefs[i].Tag < dd.ModifiedTagDefs[j].Tag
+	})
+	return dd
+}
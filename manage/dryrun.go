@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package manage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/samkumar/mr-plotter-conf/meta"
+)
+
+// dryRunStore reads from another store but only reports the writes it is
+// asked to make.
+type dryRunStore struct {
+	Store
+	report func(change string)
+}
+
+// NewDryRunStore returns a Store that reads from store, but instead of
+// writing, calls report with a description of each change it would make.
+// Atomic updates always appear to succeed. Reads do not reflect the
+// unperformed writes.
+func NewDryRunStore(store Store, report func(change string)) Store {
+	return &dryRunStore{Store: store, report: report}
+}
+
+func (ds *dryRunStore) reportAccount(acc *accounts.MrPlotterAccount) {
+	NormalizeTags(acc)
+	ds.report(fmt.Sprintf("Would write account %s with tags: %s", acc.Username, strings.Join(sortedKeys(acc.Tags), " ")))
+}
+
+func (ds *dryRunStore) reportTagDef(tagdef *accounts.MrPlotterTagDef) {
+	ds.report(fmt.Sprintf("Would write tag definition %s with prefixes: %s", tagdef.Tag, strings.Join(sortedKeys(tagdef.PathPrefix), " ")))
+}
+
+func (ds *dryRunStore) UpsertAccount(ctx context.Context, acc *accounts.MrPlotterAccount) error {
+	ds.reportAccount(acc)
+	return nil
+}
+
+func (ds *dryRunStore) UpsertAccountAtomically(ctx context.Context, acc *accounts.MrPlotterAccount) (bool, error) {
+	ds.reportAccount(acc)
+	return true, nil
+}
+
+func (ds *dryRunStore) DeleteAccount(ctx context.Context, username string) (bool, error) {
+	acc, err := ds.Store.RetrieveAccount(ctx, username)
+	if err != nil || acc == nil {
+		return false, err
+	}
+	ds.report(fmt.Sprintf("Would delete account %s", username))
+	return true, nil
+}
+
+func (ds *dryRunStore) UpdateAccountsAtomically(ctx context.Context, usernames []string, update func(acc *accounts.MrPlotterAccount)) (bool, error) {
+	accs := make([]*accounts.MrPlotterAccount, 0, len(usernames))
+	for _, username := range usernames {
+		acc, err := ds.Store.RetrieveAccount(ctx, username)
+		if err != nil || acc == nil {
+			return false, err
+		}
+		accs = append(accs, acc)
+	}
+	ds.report(fmt.Sprintf("Would update %d accounts in a single transaction:", len(accs)))
+	for _, acc := range accs {
+		update(acc)
+		ds.reportAccount(acc)
+	}
+	return true, nil
+}
+
+func (ds *dryRunStore) RenameAccount(ctx context.Context, oldUsername string, newUsername string) (bool, error) {
+	ds.report(fmt.Sprintf("Would rename account %s to %s", oldUsername, newUsername))
+	return true, nil
+}
+
+func (ds *dryRunStore) UpsertTagDef(ctx context.Context, tagdef *accounts.MrPlotterTagDef) error {
+	ds.reportTagDef(tagdef)
+	return nil
+}
+
+func (ds *dryRunStore) UpsertTagDefAtomically(ctx context.Context, tagdef *accounts.MrPlotterTagDef) (bool, error) {
+	ds.reportTagDef(tagdef)
+	return true, nil
+}
+
+func (ds *dryRunStore) DeleteTagDef(ctx context.Context, tag string) error {
+	ds.report(fmt.Sprintf("Would delete tag definition %s", tag))
+	return nil
+}
+
+func (ds *dryRunStore) DeleteMultipleTagDefs(ctx context.Context, tagprefix string) (int64, error) {
+	tagdefs, err := ds.Store.RetrieveMultipleTagDefs(ctx, tagprefix)
+	if err != nil {
+		return 0, err
+	}
+	for _, tagdef := range tagdefs {
+		ds.report(fmt.Sprintf("Would delete tag definition %s", tagdef.Tag))
+	}
+	return int64(len(tagdefs)), nil
+}
+
+// UpsertDeletedAccount does nothing; DeleteAccount reports the deletion.
+func (ds *dryRunStore) UpsertDeletedAccount(ctx context.Context, da *meta.DeletedAccount) error {
+	return nil
+}
+
+func (ds *dryRunStore) DeleteDeletedAccount(ctx context.Context, username string) error {
+	ds.report(fmt.Sprintf("Would purge deleted account %s", username))
+	return nil
+}
+
+func (ds *dryRunStore) UpsertRole(ctx context.Context, role *meta.Role) error {
+	ds.report(fmt.Sprintf("Would define role %s: %s", role.Name, strings.Join(role.Tags, " ")))
+	return nil
+}
+
+func (ds *dryRunStore) UpsertTemporaryGrant(ctx context.Context, tg *meta.TemporaryGrant) error {
+	ds.report(fmt.Sprintf("Would record that %s holds \"%s\" until %s", tg.Username, tg.Tag, tg.Expiry.Format(time.RFC3339)))
+	return nil
+}
+
+func (ds *dryRunStore) DeleteTemporaryGrant(ctx context.Context, username string) error {
+	tg, err := ds.Store.RetrieveTemporaryGrant(ctx, username)
+	if err != nil || tg == nil {
+		return err
+	}
+	ds.report(fmt.Sprintf("Would forget the temporary grant of \"%s\" to %s", tg.Tag, username))
+	return nil
+}
+
+// AppendAuditEntry does nothing, since a preview changes nothing to record.
+func (ds *dryRunStore) AppendAuditEntry(ctx context.Context, entry *meta.AuditEntry) error {
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package manage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+)
+
+// Dump is a complete copy of a configuration's accounts and tag definitions.
+// It is encoded the same way as JSON and as YAML, so a dump can be converted
+// between the two without losing anything.
+type Dump struct {
+	Accounts []DumpAccount `json:"accounts" yaml:"accounts"`
+	TagDefs  []DumpTagDef  `json:"tagdefs" yaml:"tagdefs"`
+}
+
+// DumpAccount is an account in a Dump. The password hash is kept as the
+// bcrypt string, so it reads the same in either format.
+type DumpAccount struct {
+	Username     string   `json:"username" yaml:"username"`
+	Tags         []string `json:"tags" yaml:"tags"`
+	PasswordHash string   `json:"passwordHash" yaml:"passwordHash"`
+}
+
+// DumpTagDef is a tag definition in a Dump.
+type DumpTagDef struct {
+	Tag      string   `json:"tag" yaml:"tag"`
+	Prefixes []string `json:"prefixes" yaml:"prefixes"`
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func keySet(keys []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		set[key] = struct{}{}
+	}
+	return set
+}
+
+// NewDumpAccount returns the dumped form of an account.
+func NewDumpAccount(acc *accounts.MrPlotterAccount) DumpAccount {
+	return DumpAccount{
+		Username:     acc.Username,
+		Tags:         sortedKeys(acc.Tags),
+		PasswordHash: string(acc.PasswordHash),
+	}
+}
+
+// Account returns the account that was dumped.
+func (da *DumpAccount) Account() *accounts.MrPlotterAccount {
+	return &accounts.MrPlotterAccount{
+		Username:     da.Username,
+		Tags:         keySet(da.Tags),
+		PasswordHash: []byte(da.PasswordHash),
+	}
+}
+
+// NewDumpTagDef returns the dumped form of a tag definition.
+func NewDumpTagDef(tagdef *accounts.MrPlotterTagDef) DumpTagDef {
+	return DumpTagDef{Tag: tagdef.Tag, Prefixes: sortedKeys(tagdef.PathPrefix)}
+}
+
+// TagDef returns the tag definition that was dumped.
+func (dt *DumpTagDef) TagDef() *accounts.MrPlotterTagDef {
+	return &accounts.MrPlotterTagDef{Tag: dt.Tag, PathPrefix: keySet(dt.Prefixes)}
+}
+
+// ExportDump returns a dump of every account and tag definition, sorted by
+// name.
+func ExportDump(ctx context.Context, store Store) (*Dump, error) {
+	dump := &Dump{Accounts: []DumpAccount{}, TagDefs: []DumpTagDef{}}
+	err := store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+		dump.Accounts = append(dump.Accounts, NewDumpAccount(acc))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	tagdefs, err := store.RetrieveMultipleTagDefs(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, tagdef := range tagdefs {
+		dump.TagDefs = append(dump.TagDefs, NewDumpTagDef(tagdef))
+	}
+	return dump, nil
+}
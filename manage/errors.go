@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package manage
+
+import "errors"
+
+// The kinds of error that the manage package returns. Each error it defines
+// is one of these kinds, as reported by errors.Is, so that callers can tell,
+// for example, a missing account from a conflicting write without checking
+// for every specific error. Errors of none of these kinds come from the
+// store, and usually mean that etcd could not be reached.
+var (
+	// ErrNotFound is the kind of error returned when a record does not
+	// exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is the kind of error returned when a write conflicts with
+	// a record that exists or was changed concurrently.
+	ErrConflict = errors.New("conflict")
+
+	// ErrInvalid is the kind of error returned when an operation would
+	// leave the configuration in a state that is not allowed.
+	ErrInvalid = errors.New("invalid")
+)
+
+// kindError is an error of one of the kinds above.
+type kindError struct {
+	msg  string
+	kind error
+}
+
+func newKindError(msg string, kind error) error {
+	return &kindError{msg: msg, kind: kind}
+}
+
+func (ke *kindError) Error() string {
+	return ke.msg
+}
+
+// Is reports whether the error is of the given kind.
+func (ke *kindError) Is(target error) bool {
+	return target == ke.kind
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package manage
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+)
+
+// bcryptHash matches the modular crypt format of a bcrypt hash: a version
+// ($2$, $2a$, $2b$, or $2y$), a two-digit cost, and 53 characters of salt
+// and hash.
+var bcryptHash = regexp.MustCompile(`^\$2[aby]?\$(0[4-9]|[12][0-9]|3[01])\$[./A-Za-z0-9]{53}$`)
+
+// ErrNotBcrypt is returned when a password hash is not a well-formed bcrypt
+// hash, which is the only kind Mr. Plotter can check passwords against.
+var ErrNotBcrypt = newKindError("not a well-formed bcrypt hash", ErrInvalid)
+
+// ValidateHash returns ErrNotBcrypt unless the hash is a well-formed bcrypt
+// hash.
+func ValidateHash(hash string) error {
+	if !bcryptHash.MatchString(hash) {
+		return ErrNotBcrypt
+	}
+	return nil
+}
+
+// AddUserWithHash creates an account whose password is given by an existing
+// bcrypt hash rather than in plaintext, as when migrating accounts from
+// another system. Like AddUser, it grants the public tag as well as the
+// given tags.
+func AddUserWithHash(ctx context.Context, store Store, username string, hash string, tags []string) error {
+	if err := ValidateHash(hash); err != nil {
+		return err
+	}
+	tagSet := make(map[string]struct{}, len(tags)+1)
+	for _, tag := range tags {
+		tagSet[tag] = struct{}{}
+	}
+	tagSet[accounts.PublicTag] = struct{}{}
+	acc := &accounts.MrPlotterAccount{Username: username, Tags: tagSet, PasswordHash: []byte(hash)}
+	success, err := store.UpsertAccountAtomically(ctx, acc)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+// SetPasswordHash replaces the password hash of an existing account with an
+// existing bcrypt hash, so that an account migrated from elsewhere keeps its
+// password. The mr-plotter accounts package has no setter for a hash, so the
+// field is written directly once the hash has been validated.
+func SetPasswordHash(ctx context.Context, store Store, username string, hash string) error {
+	if err := ValidateHash(hash); err != nil {
+		return err
+	}
+	acc, err := retrieveAccount(ctx, store, username)
+	if err != nil {
+		return err
+	}
+	acc.PasswordHash = []byte(hash)
+	return upsertAccount(ctx, store, acc)
+}
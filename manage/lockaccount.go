@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package manage
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+)
+
+// LockedPasswordHash replaces the password hash of a locked account. It is
+// not a bcrypt hash, so checking any password against it fails.
+var LockedPasswordHash = []byte("!locked")
+
+// ErrNotLocked is returned when unlocking an account that is not locked.
+var ErrNotLocked = newKindError("account is not locked", ErrInvalid)
+
+// IsLocked returns true if the account has been locked by LockAccount.
+func IsLocked(acc *accounts.MrPlotterAccount) bool {
+	return bytes.Equal(acc.PasswordHash, LockedPasswordHash)
+}
+
+// LockAccount discards the password of an account, so that no password can
+// be used to log in to it until UnlockAccount gives it a new one. It returns
+// false if the account was already locked.
+func LockAccount(ctx context.Context, store Store, username string) (bool, error) {
+	acc, err := retrieveAccount(ctx, store, username)
+	if err != nil || IsLocked(acc) {
+		return false, err
+	}
+	acc.PasswordHash = LockedPasswordHash
+	if err = upsertAccount(ctx, store, acc); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UnlockAccount gives a locked account a new password.
+func UnlockAccount(ctx context.Context, store Store, username string, password string) error {
+	acc, err := retrieveAccount(ctx, store, username)
+	if err != nil {
+		return err
+	}
+	if !IsLocked(acc) {
+		return ErrNotLocked
+	}
+	if err = acc.SetPassword([]byte(password)); err != nil {
+		return err
+	}
+	return upsertAccount(ctx, store, acc)
+}
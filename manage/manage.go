@@ -0,0 +1,419 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Package manage implements the operations of the configuration tool as
+// functions that return structured results instead of printing them, so that
+// other Go programs can change a Mr. Plotter configuration without running
+// the tool or parsing its output. The operations act on a Store, which is
+// usually obtained from NewEtcdStore.
+package manage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/samkumar/mr-plotter-conf/meta"
+)
+
+var (
+	// ErrAlreadyExists is returned when creating an account or tag
+	// definition that already exists.
+	ErrAlreadyExists = newKindError("already exists", ErrConflict)
+
+	// ErrAccountNotExists is returned when an operation names an account
+	// that does not exist.
+	ErrAccountNotExists = newKindError("account does not exist", ErrNotFound)
+
+	// ErrTagNotExists is returned when an operation names a tag that is not
+	// defined.
+	ErrTagNotExists = newKindError("tag is not defined", ErrNotFound)
+
+	// ErrTxFail is returned when a record changed between being read and
+	// written, so the operation should be retried.
+	ErrTxFail = newKindError("transaction for atomic update failed", ErrConflict)
+
+	// ErrRevokePublic is returned when revoking the public tag, which every
+	// account must hold.
+	ErrRevokePublic = newKindError("all user accounts must be assigned the public tag", ErrInvalid)
+
+	// ErrTagNotHeld is returned when replacing a tag that the account does
+	// not hold.
+	ErrTagNotHeld = newKindError("account does not hold the tag", ErrNotFound)
+
+	// ErrTxnTooLarge is returned when an operation would change more
+	// accounts in a single transaction than etcd allows.
+	ErrTxnTooLarge = newKindError("too many accounts for a single transaction", ErrInvalid)
+
+	// ErrLastPrefix is returned when removing every prefix from a tag
+	// definition, which must always have at least one.
+	ErrLastPrefix = newKindError("each tag must be assigned at least one prefix", ErrInvalid)
+)
+
+// AddUser creates an account with the given password and tags. The public
+// tag is always granted.
+func AddUser(ctx context.Context, store Store, username string, password string, tags []string) error {
+	tagSet := make(map[string]struct{}, len(tags)+1)
+	for _, tag := range tags {
+		tagSet[tag] = struct{}{}
+	}
+	tagSet[accounts.PublicTag] = struct{}{}
+	acc := &accounts.MrPlotterAccount{Username: username, Tags: tagSet}
+	if err := acc.SetPassword([]byte(password)); err != nil {
+		return err
+	}
+	success, err := store.UpsertAccountAtomically(ctx, acc)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+// SetPassword changes the password of an existing account.
+func SetPassword(ctx context.Context, store Store, username string, password string) error {
+	acc, err := retrieveAccount(ctx, store, username)
+	if err != nil {
+		return err
+	}
+	if err = acc.SetPassword([]byte(password)); err != nil {
+		return err
+	}
+	return upsertAccount(ctx, store, acc)
+}
+
+// TouchAccount rewrites an account unchanged, so that its modification time
+// becomes the current time.
+func TouchAccount(ctx context.Context, store Store, username string) error {
+	acc, err := retrieveAccount(ctx, store, username)
+	if err != nil {
+		return err
+	}
+	return upsertAccount(ctx, store, acc)
+}
+
+// RenameUser moves an account, with its tags and password hash, to a new
+// username in a single write.
+func RenameUser(ctx context.Context, store Store, oldUsername string, newUsername string) error {
+	if _, err := retrieveAccount(ctx, store, oldUsername); err != nil {
+		return err
+	}
+	existing, err := store.RetrieveAccount(ctx, newUsername)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrAlreadyExists
+	}
+	renamed, err := store.RenameAccount(ctx, oldUsername, newUsername)
+	if err != nil {
+		return err
+	}
+	if !renamed {
+		return ErrTxFail
+	}
+	return nil
+}
+
+// DeleteUser deletes an account, first recording a tombstone from which it
+// can be restored until it is purged. It returns false if there was no such
+// account. A tag that the account holds only through a temporary grant is
+// left out of the tombstone, since the grant is deleted with the account.
+func DeleteUser(ctx context.Context, store Store, username string) (bool, error) {
+	acc, err := store.RetrieveAccount(ctx, username)
+	if err != nil || acc == nil {
+		return false, err
+	}
+	tg, err := store.RetrieveTemporaryGrant(ctx, acc.Username)
+	if err != nil {
+		return false, err
+	}
+	if tg != nil {
+		delete(acc.Tags, tg.Tag)
+	}
+	err = store.UpsertDeletedAccount(ctx, meta.NewDeletedAccount(acc, time.Now()))
+	if err != nil {
+		return false, err
+	}
+	return store.DeleteAccount(ctx, acc.Username)
+}
+
+// GrantTags grants tags to an account. It returns the tags that the account
+// did not already hold.
+func GrantTags(ctx context.Context, store Store, username string, tags []string) ([]string, error) {
+	acc, err := retrieveAccount(ctx, store, username)
+	if err != nil {
+		return nil, err
+	}
+	changed := []string{}
+	for _, tag := range tags {
+		if _, ok := acc.Tags[tag]; !ok {
+			acc.Tags[tag] = struct{}{}
+			changed = append(changed, tag)
+		}
+	}
+	if err = upsertAccount(ctx, store, acc); err != nil {
+		return nil, err
+	}
+	return changed, ClearTemporaryGrant(ctx, store, acc.Username, tags)
+}
+
+// ClearTemporaryGrant deletes the temporary grant of a user if it is for one
+// of the given tags. It should be called whenever those tags are granted or
+// revoked other than by the temporary grant itself: a tag granted outright
+// must not be revoked when the grant expires, and a revoked tag leaves
+// nothing to revoke.
+func ClearTemporaryGrant(ctx context.Context, store Store, username string, tags []string) error {
+	tg, err := store.RetrieveTemporaryGrant(ctx, username)
+	if err != nil || tg == nil {
+		return err
+	}
+	for _, tag := range tags {
+		if tag == tg.Tag {
+			return store.DeleteTemporaryGrant(ctx, username)
+		}
+	}
+	return nil
+}
+
+// MaxTxnAccounts is the most accounts that GrantTagsAtomically changes in one
+// transaction. It is etcd's default limit on the operations in a
+// transaction.
+const MaxTxnAccounts = 128
+
+// GrantTagsAtomically grants tags to several accounts in a single
+// transaction, so that either every account gains them or none does.
+func GrantTagsAtomically(ctx context.Context, store Store, usernames []string, tags []string) error {
+	if len(usernames) > MaxTxnAccounts {
+		return ErrTxnTooLarge
+	}
+	for _, username := range usernames {
+		if _, err := retrieveAccount(ctx, store, username); err != nil {
+			return err
+		}
+	}
+	success, err := store.UpdateAccountsAtomically(ctx, usernames, func(acc *accounts.MrPlotterAccount) {
+		if acc.Tags == nil {
+			acc.Tags = make(map[string]struct{}, len(tags))
+		}
+		for _, tag := range tags {
+			acc.Tags[tag] = struct{}{}
+		}
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "too many operations in txn request") {
+			return ErrTxnTooLarge
+		}
+		return err
+	}
+	if !success {
+		return ErrTxFail
+	}
+	for _, username := range usernames {
+		if err = ClearTemporaryGrant(ctx, store, username, tags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RevokeTags revokes tags from an account. It returns the tags that the
+// account held. The public tag cannot be revoked.
+func RevokeTags(ctx context.Context, store Store, username string, tags []string) ([]string, error) {
+	acc, err := retrieveAccount(ctx, store, username)
+	if err != nil {
+		return nil, err
+	}
+	changed := []string{}
+	for _, tag := range tags {
+		if tag == accounts.PublicTag {
+			return nil, ErrRevokePublic
+		}
+		if _, ok := acc.Tags[tag]; ok {
+			delete(acc.Tags, tag)
+			changed = append(changed, tag)
+		}
+	}
+	if err = upsertAccount(ctx, store, acc); err != nil {
+		return nil, err
+	}
+	return changed, ClearTemporaryGrant(ctx, store, acc.Username, tags)
+}
+
+// SwapTag replaces oldTag with newTag on an account in a single write, so
+// that the account never holds both or neither. newTag must be defined,
+// unless it is the all or public tag. If the account does not hold oldTag,
+// SwapTag returns ErrTagNotHeld, or if force is set, grants newTag anyway.
+// It returns whether the account held oldTag.
+func SwapTag(ctx context.Context, store Store, username string, oldTag string, newTag string, force bool) (bool, error) {
+	if oldTag == accounts.PublicTag {
+		return false, ErrRevokePublic
+	}
+	if newTag != accounts.AllTag && newTag != accounts.PublicTag {
+		if _, err := retrieveTagDef(ctx, store, newTag); err != nil {
+			return false, err
+		}
+	}
+	acc, err := retrieveAccount(ctx, store, username)
+	if err != nil {
+		return false, err
+	}
+	_, held := acc.Tags[oldTag]
+	if !held && !force {
+		return false, ErrTagNotHeld
+	}
+	delete(acc.Tags, oldTag)
+	acc.Tags[newTag] = struct{}{}
+	if err = upsertAccount(ctx, store, acc); err != nil {
+		return held, err
+	}
+	return held, ClearTemporaryGrant(ctx, store, acc.Username, []string{oldTag, newTag})
+}
+
+// DefineTag creates a tag definition with the given prefixes.
+func DefineTag(ctx context.Context, store Store, tag string, prefixes []string) error {
+	pfxSet := make(map[string]struct{}, len(prefixes))
+	for _, pfx := range prefixes {
+		pfxSet[pfx] = struct{}{}
+	}
+	tagdef := &accounts.MrPlotterTagDef{Tag: tag, PathPrefix: pfxSet}
+	success, err := store.UpsertTagDefAtomically(ctx, tagdef)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+// AddPrefixes adds prefixes to a tag definition. It returns the prefixes
+// that the definition did not already have.
+func AddPrefixes(ctx context.Context, store Store, tag string, prefixes []string) ([]string, error) {
+	tagdef, err := retrieveTagDef(ctx, store, tag)
+	if err != nil {
+		return nil, err
+	}
+	changed := []string{}
+	for _, pfx := range prefixes {
+		if _, ok := tagdef.PathPrefix[pfx]; !ok {
+			tagdef.PathPrefix[pfx] = struct{}{}
+			changed = append(changed, pfx)
+		}
+	}
+	if err = upsertTagDef(ctx, store, tagdef); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// RemovePrefixes removes prefixes from a tag definition. It returns the
+// prefixes that the definition had. A tag definition cannot be left without
+// prefixes; use DeleteTagDef in the accounts package instead.
+func RemovePrefixes(ctx context.Context, store Store, tag string, prefixes []string) ([]string, error) {
+	tagdef, err := retrieveTagDef(ctx, store, tag)
+	if err != nil {
+		return nil, err
+	}
+	changed := []string{}
+	for _, pfx := range prefixes {
+		if _, ok := tagdef.PathPrefix[pfx]; ok {
+			if len(tagdef.PathPrefix) == 1 {
+				return nil, ErrLastPrefix
+			}
+			delete(tagdef.PathPrefix, pfx)
+			changed = append(changed, pfx)
+		}
+	}
+	if err = upsertTagDef(ctx, store, tagdef); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// RetrieveAllTagDefs returns every tag definition, keyed by tag, using a
+// single range query. Commands that resolve the tags of many accounts should
+// use this rather than retrieving each tag definition as it is needed.
+func RetrieveAllTagDefs(ctx context.Context, store Store) (map[string]*accounts.MrPlotterTagDef, error) {
+	tagdefs, err := store.RetrieveMultipleTagDefs(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	byTag := make(map[string]*accounts.MrPlotterTagDef, len(tagdefs))
+	for _, tagdef := range tagdefs {
+		byTag[tagdef.Tag] = tagdef
+	}
+	return byTag, nil
+}
+
+func retrieveAccount(ctx context.Context, store Store, username string) (*accounts.MrPlotterAccount, error) {
+	acc, err := store.RetrieveAccount(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if acc == nil {
+		return nil, ErrAccountNotExists
+	}
+	return acc, nil
+}
+
+func upsertAccount(ctx context.Context, store Store, acc *accounts.MrPlotterAccount) error {
+	success, err := store.UpsertAccountAtomically(ctx, acc)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return ErrTxFail
+	}
+	return nil
+}
+
+func retrieveTagDef(ctx context.Context, store Store, tag string) (*accounts.MrPlotterTagDef, error) {
+	tagdef, err := store.RetrieveTagDef(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	if tagdef == nil {
+		return nil, ErrTagNotExists
+	}
+	return tagdef, nil
+}
+
+func upsertTagDef(ctx context.Context, store Store, tagdef *accounts.MrPlotterTagDef) error {
+	success, err := store.UpsertTagDefAtomically(ctx, tagdef)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return ErrTxFail
+	}
+	return nil
+}
@@ -0,0 +1,445 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package manage
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/samkumar/mr-plotter-conf/meta"
+)
+
+/*
+ * The atomic updates of the accounts package only succeed if the record has
+ * not changed since it was read, which it tracks with a revision that is
+ * not exported. The memory store instead remembers the revision at which it
+ * handed out each copy of a record, keyed by the copy's address. These are
+ * never forgotten, which is fine for the short-lived stores of tests.
+ */
+
+// memStore keeps the configuration in memory.
+type memStore struct {
+	lock        sync.Mutex
+	rev         int64
+	accounts    map[string]*accounts.MrPlotterAccount
+	accountRevs map[string]int64
+	readAccount map[*accounts.MrPlotterAccount]int64
+	tagdefs     map[string]*accounts.MrPlotterTagDef
+	tagdefRevs  map[string]int64
+	readTagDef  map[*accounts.MrPlotterTagDef]int64
+	modified    map[string]time.Time
+	deleted     map[string]*meta.DeletedAccount
+	roles       map[string]*meta.Role
+	tempgrants  map[string]*meta.TemporaryGrant
+	auditlog    []*meta.AuditEntry
+}
+
+// NewMemoryStore returns an empty Store that keeps the configuration in
+// memory rather than in etcd, so that tests can run commands without an etcd
+// cluster.
+func NewMemoryStore() Store {
+	return &memStore{
+		accounts:    make(map[string]*accounts.MrPlotterAccount),
+		accountRevs: make(map[string]int64),
+		readAccount: make(map[*accounts.MrPlotterAccount]int64),
+		tagdefs:     make(map[string]*accounts.MrPlotterTagDef),
+		tagdefRevs:  make(map[string]int64),
+		readTagDef:  make(map[*accounts.MrPlotterTagDef]int64),
+		modified:    make(map[string]time.Time),
+		deleted:     make(map[string]*meta.DeletedAccount),
+		roles:       make(map[string]*meta.Role),
+		tempgrants:  make(map[string]*meta.TemporaryGrant),
+	}
+}
+
+func copySet(set map[string]struct{}) map[string]struct{} {
+	if set == nil {
+		return nil
+	}
+	copied := make(map[string]struct{}, len(set))
+	for key := range set {
+		copied[key] = struct{}{}
+	}
+	return copied
+}
+
+// copyAccount returns a copy of a stored account, remembering the revision
+// at which it was read.
+func (ms *memStore) copyAccount(acc *accounts.MrPlotterAccount) *accounts.MrPlotterAccount {
+	copied := &accounts.MrPlotterAccount{
+		Username:     acc.Username,
+		Tags:         copySet(acc.Tags),
+		PasswordHash: append([]byte(nil), acc.PasswordHash...),
+	}
+	ms.readAccount[copied] = ms.accountRevs[acc.Username]
+	return copied
+}
+
+func (ms *memStore) copyTagDef(tagdef *accounts.MrPlotterTagDef) *accounts.MrPlotterTagDef {
+	copied := &accounts.MrPlotterTagDef{Tag: tagdef.Tag, PathPrefix: copySet(tagdef.PathPrefix)}
+	ms.readTagDef[copied] = ms.tagdefRevs[tagdef.Tag]
+	return copied
+}
+
+func (ms *memStore) putAccount(acc *accounts.MrPlotterAccount) {
+	NormalizeTags(acc)
+	ms.rev++
+	ms.accounts[acc.Username] = &accounts.MrPlotterAccount{
+		Username:     acc.Username,
+		Tags:         copySet(acc.Tags),
+		PasswordHash: append([]byte(nil), acc.PasswordHash...),
+	}
+	ms.accountRevs[acc.Username] = ms.rev
+	ms.modified[acc.Username] = time.Now()
+}
+
+func (ms *memStore) putTagDef(tagdef *accounts.MrPlotterTagDef) {
+	ms.rev++
+	ms.tagdefs[tagdef.Tag] = &accounts.MrPlotterTagDef{Tag: tagdef.Tag, PathPrefix: copySet(tagdef.PathPrefix)}
+	ms.tagdefRevs[tagdef.Tag] = ms.rev
+}
+
+// sortedNames returns the names that begin with prefix, in order.
+func sortedNames(names []string, prefix string) []string {
+	matching := make([]string, 0, len(names))
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			matching = append(matching, name)
+		}
+	}
+	sort.Strings(matching)
+	return matching
+}
+
+func (ms *memStore) accountNames(prefix string) []string {
+	names := make([]string, 0, len(ms.accounts))
+	for name := range ms.accounts {
+		names = append(names, name)
+	}
+	return sortedNames(names, prefix)
+}
+
+func (ms *memStore) tagNames(prefix string) []string {
+	names := make([]string, 0, len(ms.tagdefs))
+	for name := range ms.tagdefs {
+		names = append(names, name)
+	}
+	return sortedNames(names, prefix)
+}
+
+func (ms *memStore) RetrieveAccount(ctx context.Context, username string) (*accounts.MrPlotterAccount, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	acc, ok := ms.accounts[username]
+	if !ok {
+		return nil, nil
+	}
+	return ms.copyAccount(acc), nil
+}
+
+func (ms *memStore) UpsertAccount(ctx context.Context, acc *accounts.MrPlotterAccount) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	ms.putAccount(acc)
+	return nil
+}
+
+func (ms *memStore) UpsertAccountAtomically(ctx context.Context, acc *accounts.MrPlotterAccount) (bool, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.readAccount[acc] != ms.accountRevs[acc.Username] {
+		return false, nil
+	}
+	ms.putAccount(acc)
+	ms.readAccount[acc] = ms.rev
+	return true, nil
+}
+
+func (ms *memStore) DeleteAccount(ctx context.Context, username string) (bool, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if _, ok := ms.accounts[username]; !ok {
+		return false, nil
+	}
+	delete(ms.accounts, username)
+	delete(ms.accountRevs, username)
+	delete(ms.modified, username)
+	delete(ms.tempgrants, username)
+	return true, nil
+}
+
+func (ms *memStore) RetrieveMultipleAccounts(ctx context.Context, usernameprefix string) ([]*accounts.MrPlotterAccount, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	names := ms.accountNames(usernameprefix)
+	accs := make([]*accounts.MrPlotterAccount, 0, len(names))
+	for _, name := range names {
+		accs = append(accs, ms.copyAccount(ms.accounts[name]))
+	}
+	return accs, nil
+}
+
+func (ms *memStore) UpdateAccountsAtomically(ctx context.Context, usernames []string, update func(acc *accounts.MrPlotterAccount)) (bool, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	accs := make([]*accounts.MrPlotterAccount, 0, len(usernames))
+	for _, username := range usernames {
+		acc, ok := ms.accounts[username]
+		if !ok {
+			return false, nil
+		}
+		accs = append(accs, ms.copyAccount(acc))
+	}
+	for _, acc := range accs {
+		update(acc)
+		ms.putAccount(acc)
+	}
+	return true, nil
+}
+
+func (ms *memStore) RenameAccount(ctx context.Context, oldUsername string, newUsername string) (bool, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	acc, ok := ms.accounts[oldUsername]
+	if _, taken := ms.accounts[newUsername]; !ok || taken {
+		return false, nil
+	}
+	acc.Username = newUsername
+	delete(ms.accounts, oldUsername)
+	delete(ms.accountRevs, oldUsername)
+	delete(ms.modified, oldUsername)
+	ms.putAccount(acc)
+	if tg, ok := ms.tempgrants[oldUsername]; ok {
+		tg.Username = newUsername
+		ms.tempgrants[newUsername] = tg
+		delete(ms.tempgrants, oldUsername)
+	}
+	return true, nil
+}
+
+func (ms *memStore) ForEachAccount(ctx context.Context, usernameprefix string, fn func(acc *accounts.MrPlotterAccount) error) error {
+	accs, err := ms.RetrieveMultipleAccounts(ctx, usernameprefix)
+	if err != nil {
+		return err
+	}
+	for _, acc := range accs {
+		if err = fn(acc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *memStore) RetrieveAccountModifiedTimes(ctx context.Context) (map[string]time.Time, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	times := make(map[string]time.Time, len(ms.modified))
+	for username, modified := range ms.modified {
+		times[username] = modified
+	}
+	return times, nil
+}
+
+func (ms *memStore) RetrieveTagDef(ctx context.Context, tag string) (*accounts.MrPlotterTagDef, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	tagdef, ok := ms.tagdefs[tag]
+	if !ok {
+		return nil, nil
+	}
+	return ms.copyTagDef(tagdef), nil
+}
+
+func (ms *memStore) UpsertTagDef(ctx context.Context, tagdef *accounts.MrPlotterTagDef) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	ms.putTagDef(tagdef)
+	return nil
+}
+
+func (ms *memStore) UpsertTagDefAtomically(ctx context.Context, tagdef *accounts.MrPlotterTagDef) (bool, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.readTagDef[tagdef] != ms.tagdefRevs[tagdef.Tag] {
+		return false, nil
+	}
+	ms.putTagDef(tagdef)
+	ms.readTagDef[tagdef] = ms.rev
+	return true, nil
+}
+
+func (ms *memStore) DeleteTagDef(ctx context.Context, tag string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	delete(ms.tagdefs, tag)
+	delete(ms.tagdefRevs, tag)
+	return nil
+}
+
+func (ms *memStore) RetrieveMultipleTagDefs(ctx context.Context, tagprefix string) ([]*accounts.MrPlotterTagDef, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	names := ms.tagNames(tagprefix)
+	tagdefs := make([]*accounts.MrPlotterTagDef, 0, len(names))
+	for _, name := range names {
+		tagdefs = append(tagdefs, ms.copyTagDef(ms.tagdefs[name]))
+	}
+	return tagdefs, nil
+}
+
+func (ms *memStore) DeleteMultipleTagDefs(ctx context.Context, tagprefix string) (int64, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	names := ms.tagNames(tagprefix)
+	for _, name := range names {
+		delete(ms.tagdefs, name)
+		delete(ms.tagdefRevs, name)
+	}
+	return int64(len(names)), nil
+}
+
+func (ms *memStore) UpsertDeletedAccount(ctx context.Context, da *meta.DeletedAccount) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	copied := *da
+	ms.deleted[da.Username] = &copied
+	return nil
+}
+
+func (ms *memStore) RetrieveDeletedAccount(ctx context.Context, username string) (*meta.DeletedAccount, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	da, ok := ms.deleted[username]
+	if !ok {
+		return nil, nil
+	}
+	copied := *da
+	return &copied, nil
+}
+
+func (ms *memStore) RetrieveAllDeletedAccounts(ctx context.Context) ([]*meta.DeletedAccount, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	das := make([]*meta.DeletedAccount, 0, len(ms.deleted))
+	for _, da := range ms.deleted {
+		copied := *da
+		das = append(das, &copied)
+	}
+	sort.Slice(das, func(i, j int) bool {
+		return das[i].Username < das[j].Username
+	})
+	return das, nil
+}
+
+func (ms *memStore) DeleteDeletedAccount(ctx context.Context, username string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	delete(ms.deleted, username)
+	return nil
+}
+
+func (ms *memStore) RetrieveRole(ctx context.Context, name string) (*meta.Role, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	role, ok := ms.roles[name]
+	if !ok {
+		return nil, nil
+	}
+	return &meta.Role{Name: role.Name, Tags: append([]string(nil), role.Tags...)}, nil
+}
+
+func (ms *memStore) UpsertRole(ctx context.Context, role *meta.Role) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	ms.roles[role.Name] = &meta.Role{Name: role.Name, Tags: append([]string(nil), role.Tags...)}
+	return nil
+}
+
+func (ms *memStore) RetrieveTemporaryGrant(ctx context.Context, username string) (*meta.TemporaryGrant, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	tg, ok := ms.tempgrants[username]
+	if !ok {
+		return nil, nil
+	}
+	copied := *tg
+	return &copied, nil
+}
+
+func (ms *memStore) RetrieveAllTemporaryGrants(ctx context.Context) ([]*meta.TemporaryGrant, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	tgs := make([]*meta.TemporaryGrant, 0, len(ms.tempgrants))
+	for _, tg := range ms.tempgrants {
+		copied := *tg
+		tgs = append(tgs, &copied)
+	}
+	sort.Slice(tgs, func(i, j int) bool {
+		return tgs[i].Username < tgs[j].Username
+	})
+	return tgs, nil
+}
+
+func (ms *memStore) UpsertTemporaryGrant(ctx context.Context, tg *meta.TemporaryGrant) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	copied := *tg
+	ms.tempgrants[tg.Username] = &copied
+	return nil
+}
+
+func (ms *memStore) DeleteTemporaryGrant(ctx context.Context, username string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	delete(ms.tempgrants, username)
+	return nil
+}
+
+func (ms *memStore) AppendAuditEntry(ctx context.Context, entry *meta.AuditEntry) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	copied := *entry
+	copied.Args = append([]string(nil), entry.Args...)
+	ms.auditlog = append(ms.auditlog, &copied)
+	return nil
+}
+
+func (ms *memStore) RetrieveRecentAuditEntries(ctx context.Context, n int64) ([]*meta.AuditEntry, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	start := int64(len(ms.auditlog)) - n
+	if start < 0 {
+		start = 0
+	}
+	return append([]*meta.AuditEntry(nil), ms.auditlog[start:]...), nil
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package manage
+
+import (
+	"sync"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/samkumar/mr-plotter-conf/meta"
+)
+
+/*
+ * The accounts and meta packages prepend a package-global prefix to their
+ * keys, which SetEtcdKeyPrefix sets once at startup. Stores bound to another
+ * prefix never change it: they pass their prefix to the meta functions that
+ * take one, and read and write accounts and tag definitions through meta
+ * rather than the accounts package, which cannot take a prefix. Calls that
+ * do not go through a store therefore always use the global prefix.
+ */
+var prefixLock sync.Mutex
+var defaultPrefix string
+
+// SetEtcdKeyPrefix sets the configuration-specific prefix prepended to each
+// key by stores from NewEtcdStore, and by the accounts and meta packages. It
+// should be used instead of setting the prefix in those packages directly,
+// so that the stores and the packages agree.
+func SetEtcdKeyPrefix(prefix string) {
+	prefixLock.Lock()
+	defer prefixLock.Unlock()
+	defaultPrefix = prefix
+	accounts.SetEtcdKeyPrefix(prefix)
+	meta.SetEtcdKeyPrefix(prefix)
+}
+
+// keyPrefix returns the configuration prefix of the store.
+func (es *etcdStore) keyPrefix() string {
+	if es.bound {
+		return es.prefix
+	}
+	prefixLock.Lock()
+	defer prefixLock.Unlock()
+	return defaultPrefix
+}
+
+// readAt remembers the revision at which a bound store read an account or
+// tag definition, for a later atomic update of it.
+func (es *etcdStore) readAt(record interface{}, rev int64) {
+	es.revLock.Lock()
+	defer es.revLock.Unlock()
+	es.revs[record] = rev
+}
+
+// revision returns the revision at which a bound store read an account or
+// tag definition, or zero if it did not read it.
+func (es *etcdStore) revision(record interface{}) int64 {
+	es.revLock.Lock()
+	defer es.revLock.Unlock()
+	return es.revs[record]
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package manage
+
+import (
+	"context"
+	"time"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/samkumar/mr-plotter-conf/meta"
+
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// ErrReadOnly is returned when a snapshot store is asked to make a change.
+var ErrReadOnly = newKindError("a snapshot of the configuration cannot be changed", ErrInvalid)
+
+// snapshotStore reads the configuration as it was at a single etcd
+// revision, so that commands reading many records see them consistently.
+type snapshotStore struct {
+	es  *etcdStore
+	rev int64
+}
+
+// NewSnapshotStore returns a read-only Store that reads the configuration
+// under the prefix set by SetEtcdKeyPrefix as it is now, ignoring any later
+// changes. It also returns the revision it reads at.
+func NewSnapshotStore(ctx context.Context, etcdClient *etcd.Client) (Store, int64, error) {
+	es := &etcdStore{ecl: etcdClient}
+	rev, err := meta.CurrentRevision(ctx, etcdClient)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &snapshotStore{es: es, rev: rev}, rev, nil
+}
+
+func (ss *snapshotStore) RetrieveAccount(ctx context.Context, username string) (*accounts.MrPlotterAccount, error) {
+	return meta.RetrieveAccountAtRevision(ctx, ss.es.ecl, username, ss.rev)
+}
+
+func (ss *snapshotStore) UpsertAccount(ctx context.Context, acc *accounts.MrPlotterAccount) error {
+	return ErrReadOnly
+}
+
+func (ss *snapshotStore) UpsertAccountAtomically(ctx context.Context, acc *accounts.MrPlotterAccount) (bool, error) {
+	return false, ErrReadOnly
+}
+
+func (ss *snapshotStore) DeleteAccount(ctx context.Context, username string) (bool, error) {
+	return false, ErrReadOnly
+}
+
+func (ss *snapshotStore) UpdateAccountsAtomically(ctx context.Context, usernames []string, update func(acc *accounts.MrPlotterAccount)) (bool, error) {
+	return false, ErrReadOnly
+}
+
+func (ss *snapshotStore) RenameAccount(ctx context.Context, oldUsername string, newUsername string) (bool, error) {
+	return false, ErrReadOnly
+}
+
+func (ss *snapshotStore) RetrieveMultipleAccounts(ctx context.Context, usernameprefix string) ([]*accounts.MrPlotterAccount, error) {
+	return meta.RetrieveMultipleAccountsAtRevision(ctx, ss.es.ecl, usernameprefix, ss.rev)
+}
+
+func (ss *snapshotStore) ForEachAccount(ctx context.Context, usernameprefix string, fn func(acc *accounts.MrPlotterAccount) error) error {
+	return meta.ForEachAccountAtRevision(ctx, ss.es.ecl, ss.es.keyPrefix(), usernameprefix, meta.DefaultPageSize, ss.rev, fn)
+}
+
+// RetrieveAccountModifiedTimes reads the latest modification times; they
+// are not part of the configuration, so there is nothing to keep consistent.
+func (ss *snapshotStore) RetrieveAccountModifiedTimes(ctx context.Context) (map[string]time.Time, error) {
+	return ss.es.RetrieveAccountModifiedTimes(ctx)
+}
+
+func (ss *snapshotStore) RetrieveTagDef(ctx context.Context, tag string) (*accounts.MrPlotterTagDef, error) {
+	return meta.RetrieveTagDefAtRevision(ctx, ss.es.ecl, tag, ss.rev)
+}
+
+func (ss *snapshotStore) UpsertTagDef(ctx context.Context, tagdef *accounts.MrPlotterTagDef) error {
+	return ErrReadOnly
+}
+
+func (ss *snapshotStore) UpsertTagDefAtomically(ctx context.Context, tagdef *accounts.MrPlotterTagDef) (bool, error) {
+	return false, ErrReadOnly
+}
+
+func (ss *snapshotStore) DeleteTagDef(ctx context.Context, tag string) error {
+	return ErrReadOnly
+}
+
+func (ss *snapshotStore) RetrieveMultipleTagDefs(ctx context.Context, tagprefix string) ([]*accounts.MrPlotterTagDef, error) {
+	return meta.RetrieveMultipleTagDefsAtRevision(ctx, ss.es.ecl, tagprefix, ss.rev)
+}
+
+func (ss *snapshotStore) DeleteMultipleTagDefs(ctx context.Context, tagprefix string) (int64, error) {
+	return 0, ErrReadOnly
+}
+
+func (ss *snapshotStore) UpsertDeletedAccount(ctx context.Context, da *meta.DeletedAccount) error {
+	return ErrReadOnly
+}
+
+func (ss *snapshotStore) RetrieveDeletedAccount(ctx context.Context, username string) (*meta.DeletedAccount, error) {
+	return meta.RetrieveDeletedAccountAtRevision(ctx, ss.es.ecl, username, ss.rev)
+}
+
+func (ss *snapshotStore) RetrieveAllDeletedAccounts(ctx context.Context) ([]*meta.DeletedAccount, error) {
+	return meta.RetrieveAllDeletedAccountsAtRevision(ctx, ss.es.ecl, ss.rev)
+}
+
+func (ss *snapshotStore) DeleteDeletedAccount(ctx context.Context, username string) error {
+	return ErrReadOnly
+}
+
+func (ss *snapshotStore) RetrieveRole(ctx context.Context, name string) (*meta.Role, error) {
+	return meta.RetrieveRoleAtRevision(ctx, ss.es.ecl, name, ss.rev)
+}
+
+func (ss *snapshotStore) UpsertRole(ctx context.Context, role *meta.Role) error {
+	return ErrReadOnly
+}
+
+func (ss *snapshotStore) RetrieveTemporaryGrant(ctx context.Context, username string) (*meta.TemporaryGrant, error) {
+	return meta.RetrieveTemporaryGrantAtRevision(ctx, ss.es.ecl, username, ss.rev)
+}
+
+func (ss *snapshotStore) RetrieveAllTemporaryGrants(ctx context.Context) ([]*meta.TemporaryGrant, error) {
+	return meta.RetrieveAllTemporaryGrantsAtRevision(ctx, ss.es.ecl, ss.rev)
+}
+
+func (ss *snapshotStore) UpsertTemporaryGrant(ctx context.Context, tg *meta.TemporaryGrant) error {
+	return ErrReadOnly
+}
+
+func (ss *snapshotStore) DeleteTemporaryGrant(ctx context.Context, username string) error {
+	return ErrReadOnly
+}
+
+func (ss *snapshotStore) AppendAuditEntry(ctx context.Context, entry *meta.AuditEntry) error {
+	return ErrReadOnly
+}
+
+func (ss *snapshotStore) RetrieveRecentAuditEntries(ctx context.Context, n int64) ([]*meta.AuditEntry, error) {
+	return meta.RetrieveRecentAuditEntriesAtRevision(ctx, ss.es.ecl, n, ss.rev)
+}
@@ -0,0 +1,386 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package manage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+	"github.com/samkumar/mr-plotter-conf/meta"
+
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// Store is the set of operations on accounts and tag definitions that the
+// tool uses. NewEtcdStore and NewEtcdStoreWithPrefix return the
+// implementation backed by etcd, which calls into the accounts package; tests
+// may substitute the in-memory store from NewMemoryStore.
+// Implementations should pass accounts through NormalizeTags before writing
+// them.
+type Store interface {
+	RetrieveAccount(ctx context.Context, username string) (*accounts.MrPlotterAccount, error)
+	UpsertAccount(ctx context.Context, acc *accounts.MrPlotterAccount) error
+	UpsertAccountAtomically(ctx context.Context, acc *accounts.MrPlotterAccount) (bool, error)
+
+	// DeleteAccount deletes an account, together with any temporary grant
+	// to it, returning false if it did not exist.
+	DeleteAccount(ctx context.Context, username string) (bool, error)
+	RetrieveMultipleAccounts(ctx context.Context, usernameprefix string) ([]*accounts.MrPlotterAccount, error)
+
+	// UpdateAccountsAtomically applies update to each of the named
+	// accounts and writes them in a single transaction, returning false
+	// without changing any if one does not exist or changed concurrently.
+	UpdateAccountsAtomically(ctx context.Context, usernames []string, update func(acc *accounts.MrPlotterAccount)) (bool, error)
+
+	// RenameAccount moves an account to a new username in a single write,
+	// returning false if the account does not exist, the new username is
+	// taken, or the account changed while being moved.
+	RenameAccount(ctx context.Context, oldUsername string, newUsername string) (bool, error)
+
+	// ForEachAccount calls fn on each account whose username begins with
+	// usernameprefix, without holding all of them in memory at once. The
+	// accounts are only suitable for reading.
+	ForEachAccount(ctx context.Context, usernameprefix string, fn func(acc *accounts.MrPlotterAccount) error) error
+
+	// RetrieveAccountModifiedTimes returns when each account was last
+	// changed through the store, keyed by username. Accounts not changed
+	// since modification times began to be recorded are absent.
+	RetrieveAccountModifiedTimes(ctx context.Context) (map[string]time.Time, error)
+
+	RetrieveTagDef(ctx context.Context, tag string) (*accounts.MrPlotterTagDef, error)
+	UpsertTagDef(ctx context.Context, tagdef *accounts.MrPlotterTagDef) error
+	UpsertTagDefAtomically(ctx context.Context, tagdef *accounts.MrPlotterTagDef) (bool, error)
+	DeleteTagDef(ctx context.Context, tag string) error
+	RetrieveMultipleTagDefs(ctx context.Context, tagprefix string) ([]*accounts.MrPlotterTagDef, error)
+	DeleteMultipleTagDefs(ctx context.Context, tagprefix string) (int64, error)
+
+	// UpsertDeletedAccount stores the tombstone of a deleted account.
+	UpsertDeletedAccount(ctx context.Context, da *meta.DeletedAccount) error
+	// RetrieveDeletedAccount returns the tombstone for a username, or nil if
+	// there is none.
+	RetrieveDeletedAccount(ctx context.Context, username string) (*meta.DeletedAccount, error)
+	RetrieveAllDeletedAccounts(ctx context.Context) ([]*meta.DeletedAccount, error)
+	DeleteDeletedAccount(ctx context.Context, username string) error
+
+	// RetrieveRole returns the named role, or nil if it is not defined.
+	RetrieveRole(ctx context.Context, name string) (*meta.Role, error)
+	UpsertRole(ctx context.Context, role *meta.Role) error
+
+	// RetrieveTemporaryGrant returns the temporary grant for a user, or nil
+	// if there is none.
+	RetrieveTemporaryGrant(ctx context.Context, username string) (*meta.TemporaryGrant, error)
+	RetrieveAllTemporaryGrants(ctx context.Context) ([]*meta.TemporaryGrant, error)
+	UpsertTemporaryGrant(ctx context.Context, tg *meta.TemporaryGrant) error
+	DeleteTemporaryGrant(ctx context.Context, username string) error
+
+	// AppendAuditEntry adds an entry to the end of the audit log.
+	AppendAuditEntry(ctx context.Context, entry *meta.AuditEntry) error
+	// RetrieveRecentAuditEntries returns the last n entries of the audit
+	// log, in the order in which they were written.
+	RetrieveRecentAuditEntries(ctx context.Context, n int64) ([]*meta.AuditEntry, error)
+}
+
+type etcdStore struct {
+	ecl    *etcd.Client
+	bound  bool
+	prefix string
+
+	/* The revisions at which a bound store read each record it returned. */
+	revLock sync.Mutex
+	revs    map[interface{}]int64
+}
+
+// NewEtcdStore returns a Store that keeps the configuration in etcd, under
+// the prefix set by SetEtcdKeyPrefix.
+func NewEtcdStore(etcdClient *etcd.Client) Store {
+	return &etcdStore{ecl: etcdClient}
+}
+
+// NewEtcdStoreWithPrefix returns a Store that keeps the configuration in
+// etcd under the given prefix, whatever SetEtcdKeyPrefix is set to. Stores
+// with different prefixes may be used at the same time. The store remembers
+// each account and tag definition it returns, for atomic updates, so it
+// should be used for a single command rather than kept for the life of the
+// program.
+func NewEtcdStoreWithPrefix(etcdClient *etcd.Client, prefix string) Store {
+	return &etcdStore{ecl: etcdClient, bound: true, prefix: prefix, revs: make(map[interface{}]int64)}
+}
+
+func (es *etcdStore) RetrieveAccount(ctx context.Context, username string) (*accounts.MrPlotterAccount, error) {
+	if !es.bound {
+		return accounts.RetrieveAccount(ctx, es.ecl, username)
+	}
+	acc, rev, err := meta.RetrieveAccountWithPrefix(ctx, es.ecl, es.prefix, username)
+	if acc != nil {
+		es.readAt(acc, rev)
+	}
+	return acc, err
+}
+
+// NormalizeTags cleans up an account's tags before it is written: each tag
+// is trimmed of surrounding whitespace, empty tags are dropped, and the
+// public tag, which every account must hold, is added if it is missing.
+func NormalizeTags(acc *accounts.MrPlotterAccount) {
+	tags := make(map[string]struct{}, len(acc.Tags)+1)
+	for tag := range acc.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags[tag] = struct{}{}
+		}
+	}
+	tags[accounts.PublicTag] = struct{}{}
+	acc.Tags = tags
+}
+
+func (es *etcdStore) UpsertAccount(ctx context.Context, acc *accounts.MrPlotterAccount) error {
+	NormalizeTags(acc)
+	var err error
+	if es.bound {
+		err = meta.UpsertAccountWithPrefix(ctx, es.ecl, es.prefix, acc)
+	} else {
+		err = accounts.UpsertAccount(ctx, es.ecl, acc)
+	}
+	if err != nil {
+		return err
+	}
+	if err = meta.SetAccountModifiedWithPrefix(ctx, es.ecl, es.keyPrefix(), acc.Username, time.Now()); err != nil {
+		return fmt.Errorf("account was updated, but its modification time could not be recorded: %v", err)
+	}
+	return nil
+}
+
+func (es *etcdStore) UpsertAccountAtomically(ctx context.Context, acc *accounts.MrPlotterAccount) (bool, error) {
+	NormalizeTags(acc)
+	var success bool
+	var err error
+	if es.bound {
+		success, err = meta.UpsertAccountAtomicallyWithPrefix(ctx, es.ecl, es.prefix, acc, es.revision(acc))
+	} else {
+		success, err = accounts.UpsertAccountAtomically(ctx, es.ecl, acc)
+	}
+	if !success || err != nil {
+		return success, err
+	}
+	if err = meta.SetAccountModifiedWithPrefix(ctx, es.ecl, es.keyPrefix(), acc.Username, time.Now()); err != nil {
+		return true, fmt.Errorf("account was updated, but its modification time could not be recorded: %v", err)
+	}
+	return true, nil
+}
+
+func (es *etcdStore) DeleteAccount(ctx context.Context, username string) (bool, error) {
+	prefix := es.keyPrefix()
+	deleted, err := meta.DeleteAccountWithPrefix(ctx, es.ecl, prefix, username)
+	if err != nil || !deleted {
+		return false, err
+	}
+	if err = meta.DeleteTemporaryGrantWithPrefix(ctx, es.ecl, prefix, username); err != nil {
+		return true, err
+	}
+	return true, meta.DeleteAccountModifiedWithPrefix(ctx, es.ecl, prefix, username)
+}
+
+func (es *etcdStore) UpdateAccountsAtomically(ctx context.Context, usernames []string, update func(acc *accounts.MrPlotterAccount)) (bool, error) {
+	prefix := es.keyPrefix()
+	success, err := meta.UpdateAccountsWithPrefix(ctx, es.ecl, prefix, usernames, func(acc *accounts.MrPlotterAccount) {
+		update(acc)
+		NormalizeTags(acc)
+	})
+	if !success || err != nil {
+		return success, err
+	}
+	now := time.Now()
+	for _, username := range usernames {
+		if err = meta.SetAccountModifiedWithPrefix(ctx, es.ecl, prefix, username, now); err != nil {
+			return true, fmt.Errorf("accounts were updated, but their modification times could not be recorded: %v", err)
+		}
+	}
+	return true, nil
+}
+
+func (es *etcdStore) RenameAccount(ctx context.Context, oldUsername string, newUsername string) (bool, error) {
+	prefix := es.keyPrefix()
+	renamed, err := meta.RenameAccountWithPrefix(ctx, es.ecl, prefix, oldUsername, newUsername)
+	if err != nil || !renamed {
+		return false, err
+	}
+	/* Otherwise a temporary grant would never expire from the new account. */
+	tg, err := meta.RetrieveTemporaryGrantWithPrefix(ctx, es.ecl, prefix, oldUsername)
+	if err == nil && tg != nil {
+		tg.Username = newUsername
+		if err = meta.UpsertTemporaryGrantWithPrefix(ctx, es.ecl, prefix, tg); err == nil {
+			err = meta.DeleteTemporaryGrantWithPrefix(ctx, es.ecl, prefix, oldUsername)
+		}
+	}
+	if err != nil {
+		return true, fmt.Errorf("account was renamed, but its temporary grant could not be moved: %v", err)
+	}
+	if err = meta.DeleteAccountModifiedWithPrefix(ctx, es.ecl, prefix, oldUsername); err == nil {
+		err = meta.SetAccountModifiedWithPrefix(ctx, es.ecl, prefix, newUsername, time.Now())
+	}
+	if err != nil {
+		return true, fmt.Errorf("account was renamed, but its modification time could not be recorded: %v", err)
+	}
+	return true, nil
+}
+
+func (es *etcdStore) RetrieveMultipleAccounts(ctx context.Context, usernameprefix string) ([]*accounts.MrPlotterAccount, error) {
+	if !es.bound {
+		return accounts.RetrieveMultipleAccounts(ctx, es.ecl, usernameprefix)
+	}
+	var listed []*accounts.MrPlotterAccount
+	err := es.ForEachAccount(ctx, usernameprefix, func(acc *accounts.MrPlotterAccount) error {
+		listed = append(listed, acc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	/*
+	 * Fetch each account again on its own, so that its revision is known
+	 * and it can be updated atomically. Corrupt accounts are returned as
+	 * they were listed.
+	 */
+	accs := make([]*accounts.MrPlotterAccount, 0, len(listed))
+	for _, acc := range listed {
+		if acc.Tags != nil {
+			if acc, err = es.RetrieveAccount(ctx, acc.Username); err != nil {
+				return nil, err
+			}
+		}
+		if acc != nil {
+			accs = append(accs, acc)
+		}
+	}
+	return accs, nil
+}
+
+func (es *etcdStore) ForEachAccount(ctx context.Context, usernameprefix string, fn func(acc *accounts.MrPlotterAccount) error) error {
+	return meta.ForEachAccountWithPrefix(ctx, es.ecl, es.keyPrefix(), usernameprefix, meta.DefaultPageSize, fn)
+}
+
+func (es *etcdStore) RetrieveAccountModifiedTimes(ctx context.Context) (map[string]time.Time, error) {
+	return meta.RetrieveAccountModifiedTimesWithPrefix(ctx, es.ecl, es.keyPrefix())
+}
+
+func (es *etcdStore) RetrieveTagDef(ctx context.Context, tag string) (*accounts.MrPlotterTagDef, error) {
+	if !es.bound {
+		return accounts.RetrieveTagDef(ctx, es.ecl, tag)
+	}
+	tagdef, rev, err := meta.RetrieveTagDefWithPrefix(ctx, es.ecl, es.prefix, tag)
+	if tagdef != nil {
+		es.readAt(tagdef, rev)
+	}
+	return tagdef, err
+}
+
+func (es *etcdStore) UpsertTagDef(ctx context.Context, tagdef *accounts.MrPlotterTagDef) error {
+	if es.bound {
+		return meta.UpsertTagDefWithPrefix(ctx, es.ecl, es.prefix, tagdef)
+	}
+	return accounts.UpsertTagDef(ctx, es.ecl, tagdef)
+}
+
+func (es *etcdStore) UpsertTagDefAtomically(ctx context.Context, tagdef *accounts.MrPlotterTagDef) (bool, error) {
+	if es.bound {
+		return meta.UpsertTagDefAtomicallyWithPrefix(ctx, es.ecl, es.prefix, tagdef, es.revision(tagdef))
+	}
+	return accounts.UpsertTagDefAtomically(ctx, es.ecl, tagdef)
+}
+
+func (es *etcdStore) DeleteTagDef(ctx context.Context, tag string) error {
+	if es.bound {
+		return meta.DeleteTagDefWithPrefix(ctx, es.ecl, es.prefix, tag)
+	}
+	return accounts.DeleteTagDef(ctx, es.ecl, tag)
+}
+
+func (es *etcdStore) RetrieveMultipleTagDefs(ctx context.Context, tagprefix string) ([]*accounts.MrPlotterTagDef, error) {
+	if es.bound {
+		return meta.RetrieveMultipleTagDefsWithPrefix(ctx, es.ecl, es.prefix, tagprefix)
+	}
+	return accounts.RetrieveMultipleTagDefs(ctx, es.ecl, tagprefix)
+}
+
+func (es *etcdStore) DeleteMultipleTagDefs(ctx context.Context, tagprefix string) (int64, error) {
+	if es.bound {
+		return meta.DeleteMultipleTagDefsWithPrefix(ctx, es.ecl, es.prefix, tagprefix)
+	}
+	return accounts.DeleteMultipleTagDefs(ctx, es.ecl, tagprefix)
+}
+
+func (es *etcdStore) UpsertDeletedAccount(ctx context.Context, da *meta.DeletedAccount) error {
+	return meta.UpsertDeletedAccountWithPrefix(ctx, es.ecl, es.keyPrefix(), da)
+}
+
+func (es *etcdStore) RetrieveDeletedAccount(ctx context.Context, username string) (*meta.DeletedAccount, error) {
+	return meta.RetrieveDeletedAccountWithPrefix(ctx, es.ecl, es.keyPrefix(), username)
+}
+
+func (es *etcdStore) RetrieveAllDeletedAccounts(ctx context.Context) ([]*meta.DeletedAccount, error) {
+	return meta.RetrieveAllDeletedAccountsWithPrefix(ctx, es.ecl, es.keyPrefix())
+}
+
+func (es *etcdStore) DeleteDeletedAccount(ctx context.Context, username string) error {
+	return meta.DeleteDeletedAccountWithPrefix(ctx, es.ecl, es.keyPrefix(), username)
+}
+
+func (es *etcdStore) RetrieveRole(ctx context.Context, name string) (*meta.Role, error) {
+	return meta.RetrieveRoleWithPrefix(ctx, es.ecl, es.keyPrefix(), name)
+}
+
+func (es *etcdStore) UpsertRole(ctx context.Context, role *meta.Role) error {
+	return meta.UpsertRoleWithPrefix(ctx, es.ecl, es.keyPrefix(), role)
+}
+
+func (es *etcdStore) RetrieveTemporaryGrant(ctx context.Context, username string) (*meta.TemporaryGrant, error) {
+	return meta.RetrieveTemporaryGrantWithPrefix(ctx, es.ecl, es.keyPrefix(), username)
+}
+
+func (es *etcdStore) RetrieveAllTemporaryGrants(ctx context.Context) ([]*meta.TemporaryGrant, error) {
+	return meta.RetrieveAllTemporaryGrantsWithPrefix(ctx, es.ecl, es.keyPrefix())
+}
+
+func (es *etcdStore) UpsertTemporaryGrant(ctx context.Context, tg *meta.TemporaryGrant) error {
+	return meta.UpsertTemporaryGrantWithPrefix(ctx, es.ecl, es.keyPrefix(), tg)
+}
+
+func (es *etcdStore) DeleteTemporaryGrant(ctx context.Context, username string) error {
+	return meta.DeleteTemporaryGrantWithPrefix(ctx, es.ecl, es.keyPrefix(), username)
+}
+
+func (es *etcdStore) AppendAuditEntry(ctx context.Context, entry *meta.AuditEntry) error {
+	return meta.AppendAuditEntryWithPrefix(ctx, es.ecl, es.keyPrefix(), entry)
+}
+
+func (es *etcdStore) RetrieveRecentAuditEntries(ctx context.Context, n int64) ([]*meta.AuditEntry, error) {
+	return meta.RetrieveRecentAuditEntriesWithPrefix(ctx, es.ecl, es.keyPrefix(), n)
+}
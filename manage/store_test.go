@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package manage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{"empty", nil, []string{accounts.PublicTag}},
+		{"clean", []string{"staff", accounts.PublicTag}, []string{"staff", accounts.PublicTag}},
+		{"stray empty tag", []string{"", "staff"}, []string{"staff", accounts.PublicTag}},
+		{"whitespace-only tag", []string{" \t", "staff"}, []string{"staff", accounts.PublicTag}},
+		{"untrimmed tag", []string{" staff\n"}, []string{"staff", accounts.PublicTag}},
+		{"untrimmed duplicate", []string{"staff", "staff "}, []string{"staff", accounts.PublicTag}},
+		{"untrimmed public tag", []string{" " + accounts.PublicTag}, []string{accounts.PublicTag}},
+	} {
+		acc := &accounts.MrPlotterAccount{Username: "alice", Tags: tagSet(tc.tags)}
+		NormalizeTags(acc)
+		if want := tagSet(tc.want); !reflect.DeepEqual(acc.Tags, want) {
+			t.Errorf("%s: got %v, want %v", tc.name, acc.Tags, want)
+		}
+	}
+}
+
+// TestAccountWritesNormalizeTags checks that each way of writing an account
+// stores a clean tag set.
+func TestAccountWritesNormalizeTags(t *testing.T) {
+	ctx := context.Background()
+	want := tagSet([]string{"staff", accounts.PublicTag})
+	for _, tc := range []struct {
+		name  string
+		write func(store Store, acc *accounts.MrPlotterAccount) error
+	}{
+		{"UpsertAccount", func(store Store, acc *accounts.MrPlotterAccount) error {
+			return store.UpsertAccount(ctx, acc)
+		}},
+		{"UpsertAccountAtomically", func(store Store, acc *accounts.MrPlotterAccount) error {
+			_, err := store.UpsertAccountAtomically(ctx, acc)
+			return err
+		}},
+		{"UpdateAccountsAtomically", func(store Store, acc *accounts.MrPlotterAccount) error {
+			if err := store.UpsertAccount(ctx, &accounts.MrPlotterAccount{Username: acc.Username}); err != nil {
+				return err
+			}
+			_, err := store.UpdateAccountsAtomically(ctx, []string{acc.Username}, func(stored *accounts.MrPlotterAccount) {
+				stored.Tags = acc.Tags
+			})
+			return err
+		}},
+	} {
+		store := NewMemoryStore()
+		acc := &accounts.MrPlotterAccount{Username: "alice", Tags: tagSet([]string{"", " staff"})}
+		if err := tc.write(store, acc); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		stored, err := store.RetrieveAccount(ctx, "alice")
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if stored == nil || !reflect.DeepEqual(stored.Tags, want) {
+			t.Errorf("%s: stored %+v, want tags %v", tc.name, stored, want)
+		}
+	}
+}
+
+func tagSet(tags []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		set[tag] = struct{}{}
+	}
+	return set
+}
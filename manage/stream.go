@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package manage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+)
+
+// Types of the records in a streamed export.
+const (
+	StreamAccount = "account"
+	StreamTagDef  = "tagdef"
+)
+
+// StreamRecord is one line of a streamed export: an account or a tag
+// definition, as named by Type, with the fields of a DumpAccount or a
+// DumpTagDef.
+type StreamRecord struct {
+	Type string `json:"type"`
+	*DumpAccount
+	*DumpTagDef
+}
+
+// ExportStream writes every account and then every tag definition to w, one
+// JSON object per line. Unlike ExportDump, it does not hold every account in
+// memory at once. It returns the number of accounts and tag definitions
+// written.
+func ExportStream(ctx context.Context, store Store, w io.Writer) (int, int, error) {
+	encoder := json.NewEncoder(w)
+	var accs, tagdefs int
+	err := store.ForEachAccount(ctx, "", func(acc *accounts.MrPlotterAccount) error {
+		da := NewDumpAccount(acc)
+		accs++
+		return encoder.Encode(&StreamRecord{Type: StreamAccount, DumpAccount: &da})
+	})
+	if err != nil {
+		return accs, tagdefs, err
+	}
+	defs, err := store.RetrieveMultipleTagDefs(ctx, "")
+	if err != nil {
+		return accs, tagdefs, err
+	}
+	for _, tagdef := range defs {
+		dt := NewDumpTagDef(tagdef)
+		if err = encoder.Encode(&StreamRecord{Type: StreamTagDef, DumpTagDef: &dt}); err != nil {
+			return accs, tagdefs, err
+		}
+		tagdefs++
+	}
+	return accs, tagdefs, nil
+}
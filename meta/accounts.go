@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// accountpath is where the accounts package stores accounts; it must match
+// that package.
+const accountpath = rootpath + "accounts/"
+
+// getRevisioned decodes the value of a key into record, returning the
+// revision at which the key was last modified, or zero if it does not exist.
+func getRevisioned(ctx context.Context, etcdClient *etcd.Client, key string, record interface{}) (int64, error) {
+	resp, err := etcdClient.Get(ctx, key)
+	if err != nil || len(resp.Kvs) == 0 {
+		return 0, err
+	}
+	if err = json.Unmarshal(resp.Kvs[0].Value, record); err != nil {
+		return 0, fmt.Errorf("could not decode %s: %v", key, err)
+	}
+	return resp.Kvs[0].ModRevision, nil
+}
+
+// putRevisioned writes record to a key if the key was last modified at the
+// given revision, or if it is zero, if the key does not exist. It returns
+// false, writing nothing, if it has been modified since.
+func putRevisioned(ctx context.Context, etcdClient *etcd.Client, key string, record interface{}, rev int64) (bool, error) {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return false, err
+	}
+	resp, err := etcdClient.Txn(ctx).
+		If(etcd.Compare(etcd.ModRevision(key), "=", rev)).
+		Then(etcd.OpPut(key, string(encoded))).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+/*
+ * The accounts package can only read and write the configuration whose
+ * prefix was given to its SetEtcdKeyPrefix, so the functions below do the
+ * same for any prefix, storing accounts in the same form. Since the revision
+ * at which the accounts package read an account is not exported, they pass
+ * it explicitly instead.
+ */
+
+// RetrieveAccountWithPrefix returns an account of the configuration with the
+// given key prefix, or nil if it does not exist, together with the revision
+// at which it was last modified.
+func RetrieveAccountWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, username string) (*accounts.MrPlotterAccount, int64, error) {
+	acc := &accounts.MrPlotterAccount{}
+	rev, err := getRevisioned(ctx, etcdClient, keyprefix+accountpath+username, acc)
+	if rev == 0 || err != nil {
+		return nil, 0, err
+	}
+	return acc, rev, nil
+}
+
+// UpsertAccountWithPrefix writes an account of the configuration with the
+// given key prefix, replacing any with the same username.
+func UpsertAccountWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, acc *accounts.MrPlotterAccount) error {
+	encoded, err := json.Marshal(acc)
+	if err != nil {
+		return err
+	}
+	_, err = etcdClient.Put(ctx, keyprefix+accountpath+acc.Username, string(encoded))
+	return err
+}
+
+// UpsertAccountAtomicallyWithPrefix writes an account of the configuration
+// with the given key prefix only if it has not changed since it was read at
+// rev by RetrieveAccountWithPrefix; a rev of zero means that the account must
+// not exist. It returns false, writing nothing, otherwise.
+func UpsertAccountAtomicallyWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, acc *accounts.MrPlotterAccount, rev int64) (bool, error) {
+	return putRevisioned(ctx, etcdClient, keyprefix+accountpath+acc.Username, acc, rev)
+}
+
+// DefaultPageSize is the number of accounts ForEachAccount fetches per
+// request if no page size is given.
+const DefaultPageSize = 500
+
+// ForEachAccount calls fn on every account whose username begins with
+// usernameprefix, in order of username. Unlike RetrieveMultipleAccounts in
+// the accounts package, it fetches pageSize accounts per request, so neither
+// the process nor etcd has to hold every account at once. All pages are read
+// at the revision of the first, so the accounts are a consistent snapshot.
+// If fn returns an error, iteration stops and that error is returned. An
+// account that cannot be decoded is passed to fn with only its username set
+// and nil Tags, so that callers can report it and carry on.
+//
+// The accounts passed to fn are only suitable for reading: to update one,
+// retrieve it again with the accounts package, so that the atomic update
+// functions know which revision it was read at.
+func ForEachAccount(ctx context.Context, etcdClient *etcd.Client, usernameprefix string, pageSize int64, fn func(acc *accounts.MrPlotterAccount) error) error {
+	return ForEachAccountWithPrefix(ctx, etcdClient, etcdprefix, usernameprefix, pageSize, fn)
+}
+
+// ForEachAccountWithPrefix is like ForEachAccount, but reads the accounts of
+// the configuration with the given prefix instead of the one set by
+// SetEtcdKeyPrefix.
+func ForEachAccountWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, usernameprefix string, pageSize int64, fn func(acc *accounts.MrPlotterAccount) error) error {
+	return ForEachAccountAtRevision(ctx, etcdClient, keyprefix, usernameprefix, pageSize, 0, fn)
+}
+
+// ForEachAccountAtRevision is like ForEachAccountWithPrefix, but reads the
+// accounts as they were at the given revision. A revision of zero means the
+// revision current when the first page is read.
+func ForEachAccountAtRevision(ctx context.Context, etcdClient *etcd.Client, keyprefix string, usernameprefix string, pageSize int64, rev int64, fn func(acc *accounts.MrPlotterAccount) error) error {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	start := keyprefix + accountpath + usernameprefix
+	end := etcd.GetPrefixRangeEnd(start)
+	for {
+		opts := []etcd.OpOption{etcd.WithRange(end), etcd.WithLimit(pageSize)}
+		if rev != 0 {
+			opts = append(opts, etcd.WithRev(rev))
+		}
+		resp, err := etcdClient.Get(ctx, start, opts...)
+		if err != nil {
+			return err
+		}
+		rev = resp.Header.Revision
+		for _, kv := range resp.Kvs {
+			acc := &accounts.MrPlotterAccount{}
+			if err = json.Unmarshal(kv.Value, acc); err != nil {
+				/* Report a corrupt entry, as the accounts package does. */
+				acc = &accounts.MrPlotterAccount{Username: string(kv.Key[len(keyprefix+accountpath):])}
+			}
+			if err = fn(acc); err != nil {
+				return err
+			}
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return nil
+		}
+		start = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
+
+// DeleteAccount deletes an account, as the accounts package does, but also
+// returns whether the account existed.
+func DeleteAccount(ctx context.Context, etcdClient *etcd.Client, username string) (bool, error) {
+	return DeleteAccountWithPrefix(ctx, etcdClient, etcdprefix, username)
+}
+
+// DeleteAccountWithPrefix is DeleteAccount for the configuration with the
+// given key prefix.
+func DeleteAccountWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, username string) (bool, error) {
+	resp, err := etcdClient.Delete(ctx, keyprefix+accountpath+username)
+	if err != nil {
+		return false, err
+	}
+	return resp.Deleted != 0, nil
+}
+
+// RenameAccount moves an account to a new username in a single transaction,
+// keeping its tags and password hash. It returns false without changing
+// anything if the account does not exist, if an account with the new
+// username exists, or if the account changed while being moved.
+func RenameAccount(ctx context.Context, etcdClient *etcd.Client, oldUsername string, newUsername string) (bool, error) {
+	return RenameAccountWithPrefix(ctx, etcdClient, etcdprefix, oldUsername, newUsername)
+}
+
+// RenameAccountWithPrefix is RenameAccount for the configuration with the
+// given key prefix.
+func RenameAccountWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, oldUsername string, newUsername string) (bool, error) {
+	oldKey := keyprefix + accountpath + oldUsername
+	newKey := keyprefix + accountpath + newUsername
+	resp, err := etcdClient.Get(ctx, oldKey)
+	if err != nil || len(resp.Kvs) == 0 {
+		return false, err
+	}
+	acc := &accounts.MrPlotterAccount{}
+	if err = json.Unmarshal(resp.Kvs[0].Value, acc); err != nil {
+		return false, fmt.Errorf("could not decode %s: %v", oldKey, err)
+	}
+	acc.Username = newUsername
+	encoded, err := json.Marshal(acc)
+	if err != nil {
+		return false, err
+	}
+	txResp, err := etcdClient.Txn(ctx).
+		If(etcd.Compare(etcd.ModRevision(oldKey), "=", resp.Kvs[0].ModRevision),
+			etcd.Compare(etcd.CreateRevision(newKey), "=", 0)).
+		Then(etcd.OpPut(newKey, string(encoded)), etcd.OpDelete(oldKey)).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return txResp.Succeeded, nil
+}
+
+// UpdateAccounts reads each of the named accounts, applies update to it, and
+// writes them all back in a single transaction, so that either every account
+// changes or none does. It returns false without changing anything if any of
+// the accounts does not exist or changed while being updated.
+func UpdateAccounts(ctx context.Context, etcdClient *etcd.Client, usernames []string, update func(acc *accounts.MrPlotterAccount)) (bool, error) {
+	return UpdateAccountsWithPrefix(ctx, etcdClient, etcdprefix, usernames, update)
+}
+
+// UpdateAccountsWithPrefix is UpdateAccounts for the configuration with the
+// given key prefix.
+func UpdateAccountsWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, usernames []string, update func(acc *accounts.MrPlotterAccount)) (bool, error) {
+	cmps := make([]etcd.Cmp, 0, len(usernames))
+	ops := make([]etcd.Op, 0, len(usernames))
+	for _, username := range usernames {
+		key := keyprefix + accountpath + username
+		resp, err := etcdClient.Get(ctx, key)
+		if err != nil || len(resp.Kvs) == 0 {
+			return false, err
+		}
+		acc := &accounts.MrPlotterAccount{}
+		if err = json.Unmarshal(resp.Kvs[0].Value, acc); err != nil {
+			return false, fmt.Errorf("could not decode %s: %v", key, err)
+		}
+		update(acc)
+		encoded, err := json.Marshal(acc)
+		if err != nil {
+			return false, err
+		}
+		cmps = append(cmps, etcd.Compare(etcd.ModRevision(key), "=", resp.Kvs[0].ModRevision))
+		ops = append(ops, etcd.OpPut(key, string(encoded)))
+	}
+	resp, err := etcdClient.Txn(ctx).If(cmps...).Then(ops...).Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+const auditkind = "auditlog"
+
+// AuditEntry records a successful change to the configuration.
+type AuditEntry struct {
+	Time     time.Time
+	Operator string
+	Command  string
+	Args     []string
+}
+
+// AppendAuditEntry adds an entry to the end of the audit log. Entries are
+// never modified once written.
+func AppendAuditEntry(ctx context.Context, etcdClient *etcd.Client, entry *AuditEntry) error {
+	return AppendAuditEntryWithPrefix(ctx, etcdClient, etcdprefix, entry)
+}
+
+// AppendAuditEntryWithPrefix is AppendAuditEntry for the configuration with
+// the given key prefix.
+func AppendAuditEntryWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, entry *AuditEntry) error {
+	/* Zero-padding the timestamp makes keys sort in time order. */
+	name := fmt.Sprintf("%020d", entry.Time.UnixNano())
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	key := getKey(keyprefix, auditkind, name)
+	resp, err := etcdClient.Txn(ctx).
+		If(etcd.Compare(etcd.CreateRevision(key), "=", 0)).
+		Then(etcd.OpPut(key, string(encoded))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return fmt.Errorf("an audit entry already exists for time %v", entry.Time)
+	}
+	return nil
+}
+
+// RetrieveRecentAuditEntries returns the last n entries of the audit log, in
+// the order in which they were written.
+func RetrieveRecentAuditEntries(ctx context.Context, etcdClient *etcd.Client, n int64) ([]*AuditEntry, error) {
+	return RetrieveRecentAuditEntriesWithPrefix(ctx, etcdClient, etcdprefix, n)
+}
+
+// RetrieveRecentAuditEntriesWithPrefix is RetrieveRecentAuditEntries for the
+// configuration with the given key prefix.
+func RetrieveRecentAuditEntriesWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, n int64) ([]*AuditEntry, error) {
+	return retrieveRecentAuditEntries(ctx, etcdClient, keyprefix, n, 0)
+}
+
+// retrieveRecentAuditEntries returns the last n entries of the audit log as
+// it was at the given revision, or the current one if it is zero.
+func retrieveRecentAuditEntries(ctx context.Context, etcdClient *etcd.Client, keyprefix string, n int64, rev int64) ([]*AuditEntry, error) {
+	opts := []etcd.OpOption{etcd.WithPrefix(), etcd.WithSort(etcd.SortByKey, etcd.SortDescend), etcd.WithLimit(n)}
+	if rev != 0 {
+		opts = append(opts, etcd.WithRev(rev))
+	}
+	resp, err := etcdClient.Get(ctx, getKindPrefix(keyprefix, auditkind), opts...)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*AuditEntry, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		entry := &AuditEntry{}
+		if err = json.Unmarshal(kv.Value, entry); err != nil {
+			return nil, fmt.Errorf("could not decode %s: %v", string(kv.Key), err)
+		}
+		entries[len(entries)-1-i] = entry
+	}
+	return entries, nil
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+const deletedkind = "deleted"
+
+// DeletedAccount is a tombstone for an account that has been deleted. It
+// holds everything needed to restore the account until it is purged.
+type DeletedAccount struct {
+	Username     string
+	Tags         []string
+	PasswordHash []byte
+	DeletedAt    time.Time
+}
+
+// NewDeletedAccount returns a tombstone for an account, deleted at the given
+// time.
+func NewDeletedAccount(acc *accounts.MrPlotterAccount, deletedAt time.Time) *DeletedAccount {
+	tags := make([]string, 0, len(acc.Tags))
+	for tag := range acc.Tags {
+		tags = append(tags, tag)
+	}
+	return &DeletedAccount{
+		Username:     acc.Username,
+		Tags:         tags,
+		PasswordHash: acc.PasswordHash,
+		DeletedAt:    deletedAt,
+	}
+}
+
+// Account returns the account that the tombstone records.
+func (da *DeletedAccount) Account() *accounts.MrPlotterAccount {
+	tags := make(map[string]struct{}, len(da.Tags))
+	for _, tag := range da.Tags {
+		tags[tag] = struct{}{}
+	}
+	return &accounts.MrPlotterAccount{
+		Username:     da.Username,
+		Tags:         tags,
+		PasswordHash: da.PasswordHash,
+	}
+}
+
+// UpsertDeletedAccount stores a tombstone, replacing any existing tombstone
+// for the same username.
+func UpsertDeletedAccount(ctx context.Context, etcdClient *etcd.Client, da *DeletedAccount) error {
+	return UpsertDeletedAccountWithPrefix(ctx, etcdClient, etcdprefix, da)
+}
+
+// UpsertDeletedAccountWithPrefix is UpsertDeletedAccount for the
+// configuration with the given key prefix.
+func UpsertDeletedAccountWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, da *DeletedAccount) error {
+	return upsertRecord(ctx, etcdClient, keyprefix, deletedkind, da.Username, da)
+}
+
+// RetrieveDeletedAccount returns the tombstone for a username, or nil if
+// there is none.
+func RetrieveDeletedAccount(ctx context.Context, etcdClient *etcd.Client, username string) (*DeletedAccount, error) {
+	return RetrieveDeletedAccountWithPrefix(ctx, etcdClient, etcdprefix, username)
+}
+
+// RetrieveDeletedAccountWithPrefix is RetrieveDeletedAccount for the
+// configuration with the given key prefix.
+func RetrieveDeletedAccountWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, username string) (*DeletedAccount, error) {
+	return retrieveDeletedAccount(ctx, etcdClient, keyprefix, username, 0)
+}
+
+// retrieveDeletedAccount returns the tombstone for a username as it was at
+// the given revision, or the current one if it is zero.
+func retrieveDeletedAccount(ctx context.Context, etcdClient *etcd.Client, keyprefix string, username string, rev int64) (*DeletedAccount, error) {
+	da := &DeletedAccount{}
+	found, err := retrieveRecordAtRevision(ctx, etcdClient, keyprefix, deletedkind, username, rev, da)
+	if !found || err != nil {
+		return nil, err
+	}
+	return da, nil
+}
+
+// RetrieveAllDeletedAccounts returns every stored tombstone.
+func RetrieveAllDeletedAccounts(ctx context.Context, etcdClient *etcd.Client) ([]*DeletedAccount, error) {
+	return RetrieveAllDeletedAccountsWithPrefix(ctx, etcdClient, etcdprefix)
+}
+
+// RetrieveAllDeletedAccountsWithPrefix is RetrieveAllDeletedAccounts for the
+// configuration with the given key prefix.
+func RetrieveAllDeletedAccountsWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string) ([]*DeletedAccount, error) {
+	return retrieveAllDeletedAccounts(ctx, etcdClient, keyprefix, 0)
+}
+
+// retrieveAllDeletedAccounts returns every tombstone stored at the given
+// revision, or the current one if it is zero.
+func retrieveAllDeletedAccounts(ctx context.Context, etcdClient *etcd.Client, keyprefix string, rev int64) ([]*DeletedAccount, error) {
+	das := []*DeletedAccount{}
+	err := retrieveRecordsAtRevision(ctx, etcdClient, keyprefix, deletedkind, "", rev, func(value []byte) error {
+		da := &DeletedAccount{}
+		if err := json.Unmarshal(value, da); err != nil {
+			return err
+		}
+		das = append(das, da)
+		return nil
+	})
+	return das, err
+}
+
+// DeleteDeletedAccount permanently removes the tombstone for a username.
+func DeleteDeletedAccount(ctx context.Context, etcdClient *etcd.Client, username string) error {
+	return DeleteDeletedAccountWithPrefix(ctx, etcdClient, etcdprefix, username)
+}
+
+// DeleteDeletedAccountWithPrefix is DeleteDeletedAccount for the
+// configuration with the given key prefix.
+func DeleteDeletedAccountWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, username string) error {
+	return deleteRecord(ctx, etcdClient, keyprefix, deletedkind, username)
+}
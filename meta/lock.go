@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package meta
+
+import (
+	"context"
+	"time"
+
+	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+)
+
+// lockTTL is how long, in seconds, the lock outlives a process that dies
+// while holding it.
+const lockTTL = 15
+
+// lockWaitNotice is how long to wait for the lock before calling the waiting
+// callback.
+const lockWaitNotice = 500 * time.Millisecond
+
+// LockConfig acquires a lock over the configuration, so that only one
+// administrator changes it at a time. If the lock is not acquired promptly,
+// waiting is called once before continuing to wait. The lock is held by an
+// etcd lease, so it is released automatically if the process dies. The
+// returned function releases the lock.
+func LockConfig(ctx context.Context, etcdClient *etcd.Client, waiting func()) (func() error, error) {
+	session, err := concurrency.NewSession(etcdClient, concurrency.WithTTL(lockTTL))
+	if err != nil {
+		return nil, err
+	}
+	mutex := concurrency.NewMutex(session, getKindPrefix(etcdprefix, "lock"))
+
+	locked := make(chan error, 1)
+	go func() {
+		locked <- mutex.Lock(ctx)
+	}()
+	select {
+	case err = <-locked:
+	case <-time.After(lockWaitNotice):
+		waiting()
+		err = <-locked
+	}
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	return func() error {
+		err := mutex.Unlock(context.Background())
+		session.Close()
+		return err
+	}, nil
+}
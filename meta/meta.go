@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Package meta stores records that the configuration tool keeps in etcd
+// alongside the Mr. Plotter accounts and tag definitions. Mr. Plotter itself
+// does not read these records.
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// rootpath is the part of every Mr. Plotter key that follows the
+// configuration-specific prefix.
+const rootpath = "mrplotter/"
+
+const metapath = rootpath + "conf/"
+
+var etcdprefix = ""
+
+// SetEtcdKeyPrefix sets the configuration-specific prefix prepended to each
+// key. It should match the prefix given to the accounts package.
+func SetEtcdKeyPrefix(prefix string) {
+	etcdprefix = prefix
+}
+
+func getKindPrefix(keyprefix string, kind string) string {
+	return fmt.Sprintf("%s%s%s/", keyprefix, metapath, kind)
+}
+
+func getKey(keyprefix string, kind string, name string) string {
+	return getKindPrefix(keyprefix, kind) + name
+}
+
+// ListKeys returns every etcd key belonging to the configuration that begins
+// with prefix, which is relative to the configuration's "mrplotter/" root.
+// This includes accounts, tag definitions, Mr. Plotter's own settings, and
+// the records kept by this tool.
+func ListKeys(ctx context.Context, etcdClient *etcd.Client, prefix string) ([]string, error) {
+	resp, err := etcdClient.Get(ctx, etcdprefix+rootpath+prefix, etcd.WithPrefix(), etcd.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		keys[i] = string(kv.Key)
+	}
+	return keys, nil
+}
+
+func upsertRecord(ctx context.Context, etcdClient *etcd.Client, keyprefix string, kind string, name string, record interface{}) error {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = etcdClient.Put(ctx, getKey(keyprefix, kind, name), string(encoded))
+	return err
+}
+
+// retrieveRecord decodes the named record into record. It returns false if
+// the record does not exist.
+func retrieveRecord(ctx context.Context, etcdClient *etcd.Client, keyprefix string, kind string, name string, record interface{}) (bool, error) {
+	return retrieveRecordAtRevision(ctx, etcdClient, keyprefix, kind, name, 0, record)
+}
+
+// retrieveRecordAtRevision is like retrieveRecord, but reads the record as
+// it was at the given revision, or the current one if it is zero.
+func retrieveRecordAtRevision(ctx context.Context, etcdClient *etcd.Client, keyprefix string, kind string, name string, rev int64, record interface{}) (bool, error) {
+	var opts []etcd.OpOption
+	if rev != 0 {
+		opts = append(opts, etcd.WithRev(rev))
+	}
+	resp, err := etcdClient.Get(ctx, getKey(keyprefix, kind, name), opts...)
+	if err != nil {
+		return false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return false, nil
+	}
+	return true, json.Unmarshal(resp.Kvs[0].Value, record)
+}
+
+// retrieveRecords calls decode on the value of every record of the given kind
+// whose name begins with prefix, in order of name.
+func retrieveRecords(ctx context.Context, etcdClient *etcd.Client, keyprefix string, kind string, prefix string, decode func(value []byte) error) error {
+	return retrieveRecordsAtRevision(ctx, etcdClient, keyprefix, kind, prefix, 0, decode)
+}
+
+// retrieveRecordsAtRevision is like retrieveRecords, but reads the records
+// as they were at the given revision, or the current one if it is zero.
+func retrieveRecordsAtRevision(ctx context.Context, etcdClient *etcd.Client, keyprefix string, kind string, prefix string, rev int64, decode func(value []byte) error) error {
+	opts := []etcd.OpOption{etcd.WithPrefix()}
+	if rev != 0 {
+		opts = append(opts, etcd.WithRev(rev))
+	}
+	resp, err := etcdClient.Get(ctx, getKey(keyprefix, kind, prefix), opts...)
+	if err != nil {
+		return err
+	}
+	for _, kv := range resp.Kvs {
+		if err = decode(kv.Value); err != nil {
+			return fmt.Errorf("could not decode %s: %v", string(kv.Key), err)
+		}
+	}
+	return nil
+}
+
+func deleteRecord(ctx context.Context, etcdClient *etcd.Client, keyprefix string, kind string, name string) error {
+	_, err := etcdClient.Delete(ctx, getKey(keyprefix, kind, name))
+	return err
+}
+
+// deleteRecords deletes every record of the given kind whose name begins with
+// prefix, returning the number deleted.
+func deleteRecords(ctx context.Context, etcdClient *etcd.Client, keyprefix string, kind string, prefix string) (int64, error) {
+	resp, err := etcdClient.Delete(ctx, getKey(keyprefix, kind, prefix), etcd.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+	return resp.Deleted, nil
+}
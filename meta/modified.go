@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+const modifiedkind = "modified"
+
+// accountModified records when an account was last changed by this tool.
+type accountModified struct {
+	Username   string
+	ModifiedAt time.Time
+}
+
+// SetAccountModified records the time at which an account was last changed.
+func SetAccountModified(ctx context.Context, etcdClient *etcd.Client, username string, modifiedAt time.Time) error {
+	return SetAccountModifiedWithPrefix(ctx, etcdClient, etcdprefix, username, modifiedAt)
+}
+
+// SetAccountModifiedWithPrefix is SetAccountModified for the configuration
+// with the given key prefix.
+func SetAccountModifiedWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, username string, modifiedAt time.Time) error {
+	return upsertRecord(ctx, etcdClient, keyprefix, modifiedkind, username, &accountModified{Username: username, ModifiedAt: modifiedAt})
+}
+
+// RetrieveAccountModifiedTimes returns the time at which each account was
+// last changed, keyed by username. Accounts last changed before this tool
+// began recording modification times are absent.
+func RetrieveAccountModifiedTimes(ctx context.Context, etcdClient *etcd.Client) (map[string]time.Time, error) {
+	return RetrieveAccountModifiedTimesWithPrefix(ctx, etcdClient, etcdprefix)
+}
+
+// RetrieveAccountModifiedTimesWithPrefix is RetrieveAccountModifiedTimes for
+// the configuration with the given key prefix.
+func RetrieveAccountModifiedTimesWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string) (map[string]time.Time, error) {
+	times := make(map[string]time.Time)
+	err := retrieveRecords(ctx, etcdClient, keyprefix, modifiedkind, "", func(value []byte) error {
+		am := &accountModified{}
+		if err := json.Unmarshal(value, am); err != nil {
+			return err
+		}
+		times[am.Username] = am.ModifiedAt
+		return nil
+	})
+	return times, err
+}
+
+// DeleteAccountModified removes the modification time of an account.
+func DeleteAccountModified(ctx context.Context, etcdClient *etcd.Client, username string) error {
+	return DeleteAccountModifiedWithPrefix(ctx, etcdClient, etcdprefix, username)
+}
+
+// DeleteAccountModifiedWithPrefix is DeleteAccountModified for the
+// configuration with the given key prefix.
+func DeleteAccountModifiedWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, username string) error {
+	return deleteRecord(ctx, etcdClient, keyprefix, modifiedkind, username)
+}
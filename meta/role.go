@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package meta
+
+import (
+	"context"
+	"encoding/json"
+
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+const rolekind = "roles"
+
+// Role is a named set of tags that accounts holding the role should have.
+// Mr. Plotter knows nothing of roles; they only exist so that accounts can
+// be checked against, and brought in line with, a template.
+type Role struct {
+	Name string
+	Tags []string
+}
+
+// UpsertRole stores a role, replacing any existing role with the same name.
+func UpsertRole(ctx context.Context, etcdClient *etcd.Client, role *Role) error {
+	return UpsertRoleWithPrefix(ctx, etcdClient, etcdprefix, role)
+}
+
+// UpsertRoleWithPrefix is UpsertRole for the configuration with the given
+// key prefix.
+func UpsertRoleWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, role *Role) error {
+	return upsertRecord(ctx, etcdClient, keyprefix, rolekind, role.Name, role)
+}
+
+// RetrieveRole returns the named role, or nil if it is not defined.
+func RetrieveRole(ctx context.Context, etcdClient *etcd.Client, name string) (*Role, error) {
+	return RetrieveRoleWithPrefix(ctx, etcdClient, etcdprefix, name)
+}
+
+// RetrieveRoleWithPrefix is RetrieveRole for the configuration with the
+// given key prefix.
+func RetrieveRoleWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, name string) (*Role, error) {
+	return retrieveRole(ctx, etcdClient, keyprefix, name, 0)
+}
+
+// retrieveRole returns the named role as it was at the given revision, or
+// the current one if it is zero.
+func retrieveRole(ctx context.Context, etcdClient *etcd.Client, keyprefix string, name string, rev int64) (*Role, error) {
+	role := &Role{}
+	found, err := retrieveRecordAtRevision(ctx, etcdClient, keyprefix, rolekind, name, rev, role)
+	if !found || err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// RetrieveAllRoles returns every defined role, in order of name.
+func RetrieveAllRoles(ctx context.Context, etcdClient *etcd.Client) ([]*Role, error) {
+	roles := []*Role{}
+	err := retrieveRecords(ctx, etcdClient, etcdprefix, rolekind, "", func(value []byte) error {
+		role := &Role{}
+		if err := json.Unmarshal(value, role); err != nil {
+			return err
+		}
+		roles = append(roles, role)
+		return nil
+	})
+	return roles, err
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// The accounts package always reads the latest revision, so the functions
+// below read its records directly when a consistent snapshot is wanted.
+
+// CurrentRevision returns the current revision of the etcd cluster. Reading
+// every record at this revision gives a consistent view of the
+// configuration, however it changes in the meantime.
+func CurrentRevision(ctx context.Context, etcdClient *etcd.Client) (int64, error) {
+	resp, err := etcdClient.Get(ctx, etcdprefix+rootpath, etcd.WithCountOnly())
+	if err != nil {
+		return 0, err
+	}
+	return resp.Header.Revision, nil
+}
+
+// getAtRevision gets a key, or every key with the prefix, at a revision.
+func getAtRevision(ctx context.Context, etcdClient *etcd.Client, key string, prefix bool, rev int64) (*etcd.GetResponse, error) {
+	opts := []etcd.OpOption{etcd.WithRev(rev)}
+	if prefix {
+		opts = append(opts, etcd.WithPrefix())
+	}
+	return etcdClient.Get(ctx, key, opts...)
+}
+
+// RetrieveAccountAtRevision returns an account as it was at the given
+// revision, or nil if it did not exist then.
+func RetrieveAccountAtRevision(ctx context.Context, etcdClient *etcd.Client, username string, rev int64) (*accounts.MrPlotterAccount, error) {
+	resp, err := getAtRevision(ctx, etcdClient, etcdprefix+accountpath+username, false, rev)
+	if err != nil || len(resp.Kvs) == 0 {
+		return nil, err
+	}
+	acc := &accounts.MrPlotterAccount{}
+	if err = json.Unmarshal(resp.Kvs[0].Value, acc); err != nil {
+		return nil, fmt.Errorf("could not decode %s: %v", string(resp.Kvs[0].Key), err)
+	}
+	return acc, nil
+}
+
+// RetrieveMultipleAccountsAtRevision returns the accounts whose usernames
+// begin with the prefix, as they were at the given revision.
+func RetrieveMultipleAccountsAtRevision(ctx context.Context, etcdClient *etcd.Client, usernameprefix string, rev int64) ([]*accounts.MrPlotterAccount, error) {
+	accs := []*accounts.MrPlotterAccount{}
+	err := ForEachAccountAtRevision(ctx, etcdClient, etcdprefix, usernameprefix, DefaultPageSize, rev, func(acc *accounts.MrPlotterAccount) error {
+		accs = append(accs, acc)
+		return nil
+	})
+	return accs, err
+}
+
+// RetrieveTagDefAtRevision returns a tag definition as it was at the given
+// revision, or nil if the tag was not defined then.
+func RetrieveTagDefAtRevision(ctx context.Context, etcdClient *etcd.Client, tag string, rev int64) (*accounts.MrPlotterTagDef, error) {
+	resp, err := getAtRevision(ctx, etcdClient, etcdprefix+tagdefpath+tag, false, rev)
+	if err != nil || len(resp.Kvs) == 0 {
+		return nil, err
+	}
+	tagdef := &accounts.MrPlotterTagDef{}
+	if err = json.Unmarshal(resp.Kvs[0].Value, tagdef); err != nil {
+		return nil, fmt.Errorf("could not decode %s: %v", string(resp.Kvs[0].Key), err)
+	}
+	return tagdef, nil
+}
+
+// RetrieveMultipleTagDefsAtRevision returns the definitions of the tags
+// beginning with the prefix, as they were at the given revision.
+func RetrieveMultipleTagDefsAtRevision(ctx context.Context, etcdClient *etcd.Client, tagprefix string, rev int64) ([]*accounts.MrPlotterTagDef, error) {
+	return retrieveMultipleTagDefs(ctx, etcdClient, etcdprefix, tagprefix, rev)
+}
+
+// retrieveMultipleTagDefs returns the definitions of the tags beginning with
+// the prefix in the configuration with the given key prefix, as they were at
+// the given revision, or the current one if it is zero.
+func retrieveMultipleTagDefs(ctx context.Context, etcdClient *etcd.Client, keyprefix string, tagprefix string, rev int64) ([]*accounts.MrPlotterTagDef, error) {
+	resp, err := getAtRevision(ctx, etcdClient, keyprefix+tagdefpath+tagprefix, true, rev)
+	if err != nil {
+		return nil, err
+	}
+	tagdefs := make([]*accounts.MrPlotterTagDef, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		tagdef := &accounts.MrPlotterTagDef{}
+		if err = json.Unmarshal(kv.Value, tagdef); err != nil {
+			return nil, fmt.Errorf("could not decode %s: %v", string(kv.Key), err)
+		}
+		tagdefs = append(tagdefs, tagdef)
+	}
+	return tagdefs, nil
+}
+
+// RetrieveDeletedAccountAtRevision returns the tombstone for a username as it
+// was at the given revision, or nil if there was none then.
+func RetrieveDeletedAccountAtRevision(ctx context.Context, etcdClient *etcd.Client, username string, rev int64) (*DeletedAccount, error) {
+	return retrieveDeletedAccount(ctx, etcdClient, etcdprefix, username, rev)
+}
+
+// RetrieveAllDeletedAccountsAtRevision returns every tombstone stored at the
+// given revision.
+func RetrieveAllDeletedAccountsAtRevision(ctx context.Context, etcdClient *etcd.Client, rev int64) ([]*DeletedAccount, error) {
+	return retrieveAllDeletedAccounts(ctx, etcdClient, etcdprefix, rev)
+}
+
+// RetrieveRoleAtRevision returns the named role as it was at the given
+// revision, or nil if it was not defined then.
+func RetrieveRoleAtRevision(ctx context.Context, etcdClient *etcd.Client, name string, rev int64) (*Role, error) {
+	return retrieveRole(ctx, etcdClient, etcdprefix, name, rev)
+}
+
+// RetrieveTemporaryGrantAtRevision returns the temporary grant for a user as
+// it was at the given revision, or nil if there was none then.
+func RetrieveTemporaryGrantAtRevision(ctx context.Context, etcdClient *etcd.Client, username string, rev int64) (*TemporaryGrant, error) {
+	return retrieveTemporaryGrant(ctx, etcdClient, etcdprefix, username, rev)
+}
+
+// RetrieveAllTemporaryGrantsAtRevision returns every temporary grant stored
+// at the given revision.
+func RetrieveAllTemporaryGrantsAtRevision(ctx context.Context, etcdClient *etcd.Client, rev int64) ([]*TemporaryGrant, error) {
+	return retrieveAllTemporaryGrants(ctx, etcdClient, etcdprefix, rev)
+}
+
+// RetrieveRecentAuditEntriesAtRevision returns the last n entries of the
+// audit log as it was at the given revision.
+func RetrieveRecentAuditEntriesAtRevision(ctx context.Context, etcdClient *etcd.Client, n int64, rev int64) ([]*AuditEntry, error) {
+	return retrieveRecentAuditEntries(ctx, etcdClient, etcdprefix, n, rev)
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package meta
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/SoftwareDefinedBuildings/mr-plotter/accounts"
+
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+// tagdefpath is where the accounts package stores tag definitions; it must
+// match that package.
+const tagdefpath = rootpath + "tagdefs/"
+
+/*
+ * Like the account functions in accounts.go, these read and write tag
+ * definitions in the same form as the accounts package, but under any
+ * prefix.
+ */
+
+// RetrieveTagDefWithPrefix returns a tag definition of the configuration
+// with the given key prefix, or nil if the tag is not defined, together with
+// the revision at which it was last modified.
+func RetrieveTagDefWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, tag string) (*accounts.MrPlotterTagDef, int64, error) {
+	tagdef := &accounts.MrPlotterTagDef{}
+	rev, err := getRevisioned(ctx, etcdClient, keyprefix+tagdefpath+tag, tagdef)
+	if rev == 0 || err != nil {
+		return nil, 0, err
+	}
+	return tagdef, rev, nil
+}
+
+// RetrieveMultipleTagDefsWithPrefix returns the definitions of the tags
+// beginning with tagprefix in the configuration with the given key prefix.
+func RetrieveMultipleTagDefsWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, tagprefix string) ([]*accounts.MrPlotterTagDef, error) {
+	return retrieveMultipleTagDefs(ctx, etcdClient, keyprefix, tagprefix, 0)
+}
+
+// UpsertTagDefWithPrefix writes a tag definition of the configuration with
+// the given key prefix, replacing any for the same tag.
+func UpsertTagDefWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, tagdef *accounts.MrPlotterTagDef) error {
+	encoded, err := json.Marshal(tagdef)
+	if err != nil {
+		return err
+	}
+	_, err = etcdClient.Put(ctx, keyprefix+tagdefpath+tagdef.Tag, string(encoded))
+	return err
+}
+
+// UpsertTagDefAtomicallyWithPrefix writes a tag definition of the
+// configuration with the given key prefix only if it has not changed since
+// it was read at rev by RetrieveTagDefWithPrefix; a rev of zero means that
+// the tag must not be defined. It returns false, writing nothing, otherwise.
+func UpsertTagDefAtomicallyWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, tagdef *accounts.MrPlotterTagDef, rev int64) (bool, error) {
+	return putRevisioned(ctx, etcdClient, keyprefix+tagdefpath+tagdef.Tag, tagdef, rev)
+}
+
+// DeleteTagDefWithPrefix deletes a tag definition of the configuration with
+// the given key prefix.
+func DeleteTagDefWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, tag string) error {
+	_, err := etcdClient.Delete(ctx, keyprefix+tagdefpath+tag)
+	return err
+}
+
+// DeleteMultipleTagDefsWithPrefix deletes the definitions of the tags
+// beginning with tagprefix in the configuration with the given key prefix,
+// returning the number deleted.
+func DeleteMultipleTagDefsWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, tagprefix string) (int64, error) {
+	resp, err := etcdClient.Delete(ctx, keyprefix+tagdefpath+tagprefix, etcd.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+	return resp.Deleted, nil
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2017, Sam Kumar <samkumar@berkeley.edu>
+ * Copyright (c) 2017, University of California, Berkeley
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *     * Neither the name of the University of California, Berkeley nor the
+ *       names of its contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNERS OR CONTRIBUTORS BE LIABLE FOR
+ * ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	etcd "github.com/coreos/etcd/clientv3"
+)
+
+const tempgrantkind = "tempgrants"
+
+// TemporaryGrant records that a tag was granted to a user only until a
+// certain time, after which it should be revoked.
+type TemporaryGrant struct {
+	Username string
+	Tag      string
+	Expiry   time.Time
+}
+
+// Expired returns true if the grant's expiry time has passed.
+func (tg *TemporaryGrant) Expired(now time.Time) bool {
+	return !now.Before(tg.Expiry)
+}
+
+// UpsertTemporaryGrant stores a temporary grant, replacing any existing
+// temporary grant for the same user.
+func UpsertTemporaryGrant(ctx context.Context, etcdClient *etcd.Client, tg *TemporaryGrant) error {
+	return UpsertTemporaryGrantWithPrefix(ctx, etcdClient, etcdprefix, tg)
+}
+
+// UpsertTemporaryGrantWithPrefix is UpsertTemporaryGrant for the
+// configuration with the given key prefix.
+func UpsertTemporaryGrantWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, tg *TemporaryGrant) error {
+	return upsertRecord(ctx, etcdClient, keyprefix, tempgrantkind, tg.Username, tg)
+}
+
+// RetrieveTemporaryGrant returns the temporary grant for a user, or nil if
+// there is none.
+func RetrieveTemporaryGrant(ctx context.Context, etcdClient *etcd.Client, username string) (*TemporaryGrant, error) {
+	return RetrieveTemporaryGrantWithPrefix(ctx, etcdClient, etcdprefix, username)
+}
+
+// RetrieveTemporaryGrantWithPrefix is RetrieveTemporaryGrant for the
+// configuration with the given key prefix.
+func RetrieveTemporaryGrantWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, username string) (*TemporaryGrant, error) {
+	return retrieveTemporaryGrant(ctx, etcdClient, keyprefix, username, 0)
+}
+
+// retrieveTemporaryGrant returns the temporary grant for a user as it was at
+// the given revision, or the current one if it is zero.
+func retrieveTemporaryGrant(ctx context.Context, etcdClient *etcd.Client, keyprefix string, username string, rev int64) (*TemporaryGrant, error) {
+	tg := &TemporaryGrant{}
+	found, err := retrieveRecordAtRevision(ctx, etcdClient, keyprefix, tempgrantkind, username, rev, tg)
+	if !found || err != nil {
+		return nil, err
+	}
+	return tg, nil
+}
+
+// RetrieveAllTemporaryGrants returns every stored temporary grant.
+func RetrieveAllTemporaryGrants(ctx context.Context, etcdClient *etcd.Client) ([]*TemporaryGrant, error) {
+	return RetrieveAllTemporaryGrantsWithPrefix(ctx, etcdClient, etcdprefix)
+}
+
+// RetrieveAllTemporaryGrantsWithPrefix is RetrieveAllTemporaryGrants for the
+// configuration with the given key prefix.
+func RetrieveAllTemporaryGrantsWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string) ([]*TemporaryGrant, error) {
+	return retrieveAllTemporaryGrants(ctx, etcdClient, keyprefix, 0)
+}
+
+// retrieveAllTemporaryGrants returns every temporary grant stored at the
+// given revision, or the current one if it is zero.
+func retrieveAllTemporaryGrants(ctx context.Context, etcdClient *etcd.Client, keyprefix string, rev int64) ([]*TemporaryGrant, error) {
+	tgs := []*TemporaryGrant{}
+	err := retrieveRecordsAtRevision(ctx, etcdClient, keyprefix, tempgrantkind, "", rev, func(value []byte) error {
+		tg := &TemporaryGrant{}
+		if err := json.Unmarshal(value, tg); err != nil {
+			return err
+		}
+		tgs = append(tgs, tg)
+		return nil
+	})
+	return tgs, err
+}
+
+// DeleteTemporaryGrant removes the temporary grant record for a user. It
+// does not modify the user's account.
+func DeleteTemporaryGrant(ctx context.Context, etcdClient *etcd.Client, username string) error {
+	return DeleteTemporaryGrantWithPrefix(ctx, etcdClient, etcdprefix, username)
+}
+
+// DeleteTemporaryGrantWithPrefix is DeleteTemporaryGrant for the
+// configuration with the given key prefix.
+func DeleteTemporaryGrantWithPrefix(ctx context.Context, etcdClient *etcd.Client, keyprefix string, username string) error {
+	return deleteRecord(ctx, etcdClient, keyprefix, tempgrantkind, username)
+}